@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/andykuszyk/depgrok/junit"
+	"github.com/andykuszyk/depgrok/sarif"
+	"github.com/andykuszyk/depgrok/search"
+	"github.com/urfave/cli"
+)
+
+// The main function for the check command - searches a directory of repos for
+// dependencies, as per the search command, then evaluates the rules of a rules file against
+// the result, printing a report of any violations and exiting with a non-zero status if
+// there are any, e.g. to fail a CI build.
+func Check(c *cli.Context) {
+	if c.String("rules") == "" {
+		log.Fatal("--rules is a required flag")
+	}
+	rules, err := search.LoadRules(c.String("rules"))
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", c.String("rules"), err)
+	}
+	var baseline *search.Report
+	if path := c.String("baseline"); path != "" {
+		report, err := search.LoadSnapshot(path)
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", path, err)
+		}
+		baseline = &report
+	} else if rules.NeedBaseline() {
+		log.Fatal("--baseline is required by rules with noNewReferences")
+	}
+	// The dependencies named by the rules, and those of the baseline, are searched for by
+	// default.
+	if c.String("deps") == "" {
+		seeds := rules.Seeds()
+		if baseline != nil {
+			seeds = append(seeds, baseline.Seeds()...)
+		}
+		if len(seeds) == 0 {
+			log.Fatal("--deps is required, as the rules only give dependencies by globs and there is no --baseline")
+		}
+		c.Set("deps", strings.Join(seeds, " "))
+	}
+	options := searchOptions(c)
+	dir := c.String("dir")
+	options.Roots = []string{dir}
+
+	start := time.Now()
+	searcher, err := search.NewSearcher(options)
+	if err != nil {
+		log.Fatal(err)
+	}
+	result, err := searcher.Search()
+	if err != nil {
+		log.Fatalf("Error searching %s: %v", dir, err)
+	}
+	logLevels(result)
+	logDuration(start, "Search")
+	fmt.Fprintln(os.Stderr, "")
+
+	violations := rules.Check(result.Report(), baseline)
+	printViolations(c.String("format"), rules, result.Repos, violations)
+	if len(violations) > 0 {
+		os.Exit(1)
+	}
+}
+
+// Prints the violations in the given format: text, which shows the reason for each
+// violation, followed by the location of the reference responsible, json, sarif, or junit,
+// which reports each of the rules checked against each of the repos as a test case.
+func printViolations(format string, rules search.Rules, repos []string, violations []search.Violation) {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(violations); err != nil {
+			log.Fatalf("Error writing the violations as JSON: %v", err)
+		}
+	case "sarif":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(sarif.FromViolations(violations)); err != nil {
+			log.Fatalf("Error writing the violations as SARIF: %v", err)
+		}
+	case "junit":
+		fmt.Print(xml.Header)
+		encoder := xml.NewEncoder(os.Stdout)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(junit.FromViolations(rules, repos, violations)); err != nil {
+			log.Fatalf("Error writing the violations as JUnit XML: %v", err)
+		}
+		fmt.Println("")
+	case "", "text":
+		if len(violations) == 0 {
+			fmt.Println("No violations found")
+			return
+		}
+		for _, violation := range violations {
+			fmt.Printf("%s: %s\n", violation.Rule, violation.Reason)
+			fmt.Printf("    %s/%s:%d:%d\n", violation.Reference.Repo, violation.Reference.Path,
+				violation.Reference.Line, violation.Reference.Column)
+		}
+		fmt.Printf("\n%d violations found\n", len(violations))
+	default:
+		log.Fatalf("--format must be text, json, sarif or junit, but was %s", format)
+	}
+}
@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/andykuszyk/depgrok/search"
+	"github.com/urfave/cli"
+)
+
+// The main function for the diff command - compares a snapshot saved by the search
+// command's --save flag with another snapshot, or with a fresh search of a directory of
+// repos for the same dependencies, reporting the repos, edges and references that were
+// added or removed in between.
+func Diff(c *cli.Context) {
+	if c.String("before") == "" {
+		log.Fatal("--before is a required flag")
+	}
+	before, err := search.LoadSnapshot(c.String("before"))
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", c.String("before"), err)
+	}
+
+	var after search.Report
+	if path := c.String("after"); path != "" {
+		after, err = search.LoadSnapshot(path)
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", path, err)
+		}
+	} else {
+		after = searchAgain(c, before)
+	}
+	printDiff(c.String("format"), search.DiffReports(before, after))
+}
+
+// Searches the directory given by --dir for the dependencies given by --deps, or else the
+// seeds of the before snapshot, returning the Report of the result.
+func searchAgain(c *cli.Context, before search.Report) search.Report {
+	if c.String("dir") == "" {
+		log.Fatal("Either --after or --dir is required")
+	}
+	if c.String("deps") == "" {
+		c.Set("deps", strings.Join(before.Seeds(), " "))
+	}
+	options := searchOptions(c)
+	dir := c.String("dir")
+	options.Roots = []string{dir}
+
+	defer logDuration(time.Now(), "Search")
+
+	searcher, err := search.NewSearcher(options)
+	if err != nil {
+		log.Fatal(err)
+	}
+	result, err := searcher.Search()
+	if err != nil {
+		log.Fatalf("Error searching %s: %v", dir, err)
+	}
+	logLevels(result)
+	fmt.Fprintln(os.Stderr, "")
+	return result.Report()
+}
+
+// Prints the diff in the given format: text, which lists each difference prefixed by +
+// or -, or json.
+func printDiff(format string, diff search.ReportDiff) {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(diff); err != nil {
+			log.Fatalf("Error writing the diff as JSON: %v", err)
+		}
+	case "", "text":
+		if diff.Empty() {
+			fmt.Println("No differences found")
+			return
+		}
+		printSection("Repos", diff.AddedRepos, diff.RemovedRepos)
+		added, removed := []string{}, []string{}
+		for _, edge := range diff.AddedEdges {
+			added = append(added, edge.From+" -> "+edge.To)
+		}
+		for _, edge := range diff.RemovedEdges {
+			removed = append(removed, edge.From+" -> "+edge.To)
+		}
+		printSection("Edges", added, removed)
+		added, removed = []string{}, []string{}
+		for _, reference := range diff.AddedReferences {
+			added = append(added, fmt.Sprintf("%s/%s:%d:%d %s", reference.Repo, reference.Path, reference.Line, reference.Column, reference.Dependency))
+		}
+		for _, reference := range diff.RemovedReferences {
+			removed = append(removed, fmt.Sprintf("%s/%s:%d:%d %s", reference.Repo, reference.Path, reference.Line, reference.Column, reference.Dependency))
+		}
+		printSection("References", added, removed)
+	default:
+		log.Fatalf("--format must be text or json, but was %s", format)
+	}
+}
+
+// Prints a titled section of the added and removed lines of a diff, or nothing if there
+// are none.
+func printSection(title string, added []string, removed []string) {
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", title)
+	for _, line := range added {
+		fmt.Printf("+ %s\n", line)
+	}
+	for _, line := range removed {
+		fmt.Printf("- %s\n", line)
+	}
+	fmt.Println("")
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/andykuszyk/depgrok/gitfs"
+	"github.com/andykuszyk/depgrok/search"
+)
+
+// Returns true if the directory is within the working tree of a git repository, e.g. at its
+// root, or in a project within a monorepo, judging by the .git entry at its root. Only the
+// directories from dir up to root, the directory being searched, are considered, so that a
+// directory is not mistaken for a repo just because root is itself within one, such as a
+// home directory kept in git.
+func isGitRepo(root string, dir string) bool {
+	root, dir = filepath.Clean(root), filepath.Clean(dir)
+	if relative, err := filepath.Rel(root, dir); err != nil || strings.HasPrefix(relative, "..") {
+		root = dir
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return true
+		}
+		if dir == root {
+			return false
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// Returns the git blob hash of each file in the repo whose contents in the working tree
+// match git's index, keyed by the path of the file (joined to dir). Files with unstaged
+// changes are left out, as their hashes in git's index do not reflect their contents.
+func gitBlobHashes(dir string) (map[string]string, error) {
+	lsFiles := exec.Command("git", "ls-files", "--stage", "-z")
+	lsFiles.Dir = dir
+	output, err := lsFiles.Output()
+	if err != nil {
+		return nil, err
+	}
+	hashes := map[string]string{}
+	for _, entry := range bytes.Split(output, []byte{0}) {
+		// Each entry is formatted as "<mode> <hash> <stage>\t<path>".
+		fields := strings.SplitN(string(entry), "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		info := strings.Fields(fields[0])
+		if len(info) != 3 {
+			continue
+		}
+		hashes[filepath.Join(dir, filepath.FromSlash(fields[1]))] = info[1]
+	}
+
+	diff := exec.Command("git", "diff", "--name-only", "--relative", "-z")
+	diff.Dir = dir
+	output, err = diff.Output()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range bytes.Split(output, []byte{0}) {
+		if len(path) > 0 {
+			delete(hashes, filepath.Join(dir, filepath.FromSlash(string(path))))
+		}
+	}
+	return hashes, nil
+}
+
+// Opens the tree of the given ref in each of the git repos within dir, returning them keyed
+// by the paths of the repos relative to dir, along with a function that closes them. The
+// repos are those found at the given depth, or detected by their .git directories if it is
+// zero, unless dir is itself a git repo, in which case it is the only one opened. Repos in
+// which the ref cannot be found, and directories that are not git repos, are skipped with a
+// warning.
+func openRefs(dir string, ref string, repoDepth int) (map[string]fs.FS, func(), error) {
+	options := search.WalkOptions{RepoDepth: repoDepth}
+	found, err := search.FindRepos(os.DirFS(dir), options)
+	if err != nil {
+		return nil, nil, err
+	}
+	if root := search.RootRepo(dir, options); root != "" {
+		found = []string{root}
+	}
+	repos := map[string]fs.FS{}
+	opened := []*gitfs.FS{}
+	for _, repo := range found {
+		repoDir := search.RepoDir(dir, repo, options)
+		if !isGitRepo(dir, repoDir) {
+			fmt.Fprintf(os.Stderr, "Skipping %s, as it is not a git repo\n", repo)
+			continue
+		}
+		tree, err := gitfs.Open(repoDir, ref)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", repo, err)
+			continue
+		}
+		repos[repo] = tree
+		opened = append(opened, tree)
+	}
+	return repos, func() {
+		for _, tree := range opened {
+			tree.Close()
+		}
+	}, nil
+}
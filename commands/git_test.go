@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Creates a git repo in a temporary directory containing the given files, all of which are
+// committed, returning the directory.
+func gitRepo(t *testing.T, files map[string]string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "depgrok-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=depgrok", "-c", "user.email=depgrok@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		git := exec.Command("git", args...)
+		git.Dir = dir
+		if output, err := git.CombinedOutput(); err != nil {
+			t.Fatalf("Error running git %v: %v\n%s", args, err, output)
+		}
+	}
+	return dir
+}
+
+func TestGitBlobHashes_ShouldOmitFilesWithUnstagedChanges(t *testing.T) {
+	dir := gitRepo(t, map[string]string{"a.sql": "orders\n", "b.sql": "customers\n"})
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "b.sql"), []byte("products\n"), 0644)
+
+	hashes, err := gitBlobHashes(dir)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The blob hash of "orders\n", as given by `git hash-object`.
+	if hashes[filepath.Join(dir, "a.sql")] != "e1e3bcf0993636944c10085e690d859a7ea7f2bd" {
+		t.Errorf("Unexpected hash for a.sql: %v", hashes)
+	}
+	if _, ok := hashes[filepath.Join(dir, "b.sql")]; ok {
+		t.Errorf("b.sql has unstaged changes, so should not have a hash: %v", hashes)
+	}
+	if !isGitRepo(dir, dir) {
+		t.Errorf("%s should be a git repo", dir)
+	}
+}
+
+func TestIsGitRepo_ShouldOnlyConsiderReposWithinTheDirectorySearched(t *testing.T) {
+	dir := gitRepo(t, map[string]string{"a.sql": "orders\n"})
+	defer os.RemoveAll(dir)
+	module := filepath.Join(dir, "services", "billing")
+	os.MkdirAll(module, 0755)
+
+	if !isGitRepo(dir, module) {
+		t.Errorf("%s should be within a git repo, as %s is one", module, dir)
+	}
+	if isGitRepo(filepath.Join(dir, "services"), module) {
+		t.Errorf("%s should not be a git repo when searching within %s", module, dir)
+	}
+	if isGitRepo(t.TempDir(), t.TempDir()) {
+		t.Error("An empty directory should not be a git repo")
+	}
+}
+
+func TestOpenRefs_ShouldSkipReposWithoutRef(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Rename(gitRepo(t, map[string]string{"a.sql": "orders\n"}), filepath.Join(dir, "repo1")); err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(dir, "notes"), 0755)
+
+	repos, closeRepos, err := openRefs(dir, "HEAD", 0)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeRepos()
+	if len(repos) != 1 || repos["repo1"] == nil {
+		t.Fatalf("Expected only repo1 to be opened, but got %v", repos)
+	}
+	contents, err := fs.ReadFile(repos["repo1"], "a.sql")
+	if err != nil || string(contents) != "orders\n" {
+		t.Errorf("Expected a.sql to contain orders, but got %q (%v)", contents, err)
+	}
+
+	repos, closeRepos, err = openRefs(dir, "missing", 0)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeRepos()
+	if len(repos) != 0 {
+		t.Errorf("Expected no repos to be opened, but got %v", repos)
+	}
+}
+
+func TestOpenRefs_ShouldOpenADirectoryThatIsARepoAsThatRepo(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "orders")
+	if err := os.Rename(gitRepo(t, map[string]string{"a.sql": "orders\n"}), dir); err != nil {
+		t.Fatal(err)
+	}
+
+	repos, closeRepos, err := openRefs(dir, "HEAD", 0)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeRepos()
+	if len(repos) != 1 || repos["orders"] == nil {
+		t.Fatalf("Expected only orders to be opened, but got %v", repos)
+	}
+	contents, err := fs.ReadFile(repos["orders"], "a.sql")
+	if err != nil || string(contents) != "orders\n" {
+		t.Errorf("Expected a.sql to contain orders, but got %q (%v)", contents, err)
+	}
+}
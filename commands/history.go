@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/andykuszyk/depgrok/deps"
+	"github.com/andykuszyk/depgrok/history"
+	"github.com/andykuszyk/depgrok/search"
+	"github.com/urfave/cli"
+)
+
+// The main function for the history command - searches a directory of repos for
+// dependencies, as per the search command, then uses the git history of each repo to
+// report the commit that introduced each reference found. With --removed, the files that
+// used to reference each dependency, but no longer do, are reported too, along with the
+// commit that removed the reference.
+func History(c *cli.Context) {
+	options := searchOptions(c)
+	dir := c.String("dir")
+	options.Roots = []string{dir}
+	walkOptions := search.WalkOptions{RepoDepth: options.RepoDepth, RepoMarkers: options.RepoMarkers}
+
+	defer logDuration(time.Now(), "Total time")
+
+	searcher, err := search.NewSearcher(options)
+	if err != nil {
+		log.Fatal(err)
+	}
+	result, err := searcher.Search()
+	if err != nil {
+		log.Fatalf("Error searching %s: %v", dir, err)
+	}
+
+	// Only the first reference to each dependency in each file is reported, since the
+	// history of the file is the same for all of them.
+	references := result.References
+	sort.SliceStable(references, func(i, j int) bool {
+		if references[i].Path != references[j].Path {
+			return references[i].Path < references[j].Path
+		}
+		return references[i].Line < references[j].Line
+	})
+	type fileDependency struct {
+		Repo       string
+		Path       string
+		Dependency *deps.Dependency
+	}
+	current := map[fileDependency]bool{}
+	repos := map[string]bool{}
+	for _, reference := range references {
+		repoDir := search.RepoDir(dir, reference.Repo, walkOptions)
+		if !repos[reference.Repo] {
+			repos[reference.Repo] = true
+			warnIfNoHistory(dir, reference.Repo, repoDir)
+		}
+		path, err := filepath.Rel(repoDir, reference.Path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		path = filepath.ToSlash(path)
+		key := fileDependency{Repo: reference.Repo, Path: path, Dependency: reference.Dependency}
+		if current[key] {
+			continue
+		}
+		current[key] = true
+		if !isGitRepo(dir, repoDir) {
+			continue
+		}
+
+		matcher, err := searcher.MatcherFor(path, []*deps.Dependency{reference.Dependency})
+		if err != nil {
+			log.Fatal(err)
+		}
+		commit, err := history.Introduced(repoDir, path, reference.Dependency, matcher)
+		if err != nil {
+			log.Fatalf("Error reading the history of %s: %v", reference.Path, err)
+		}
+		introduced := "not yet committed"
+		if commit != nil {
+			introduced = "introduced in " + commit.String()
+		}
+		fmt.Printf("%s/%s:%d %s %s\n", reference.Repo, path, reference.Line, reference.Dependency.Name, introduced)
+	}
+
+	if !c.Bool("removed") {
+		return
+	}
+	for _, repo := range result.Repos {
+		repoDir := search.RepoDir(dir, repo, walkOptions)
+		if !repos[repo] {
+			repos[repo] = true
+			warnIfNoHistory(dir, repo, repoDir)
+		}
+		if !isGitRepo(dir, repoDir) {
+			continue
+		}
+		searched := []*deps.Dependency{}
+		for _, dep := range result.Dependencies.Slice() {
+			if dep.Level < result.Levels {
+				searched = append(searched, dep)
+			}
+		}
+		currentReferences := map[history.Reference]bool{}
+		for key := range current {
+			if key.Repo == repo {
+				currentReferences[history.Reference{Path: key.Path, Dependency: key.Dependency}] = true
+			}
+		}
+		matcherFor := func(path string, dep *deps.Dependency) (deps.Matcher, error) {
+			return searcher.MatcherFor(path, []*deps.Dependency{dep})
+		}
+		removals, err := history.Removed(repoDir, searched, matcherFor, currentReferences)
+		if err != nil {
+			log.Fatalf("Error reading the history of %s: %v", repo, err)
+		}
+		for _, removal := range removals {
+			if searcher.Searches(removal.Path) {
+				fmt.Printf("%s/%s %s removed in %s\n", repo, removal.Path, removal.Dependency.Name, removal.Commit)
+			}
+		}
+	}
+}
+
+// Prints a warning if the history of the repo at repoDir, found within dir, cannot be
+// relied upon, either because it is not a git repo, or because it is a shallow clone.
+func warnIfNoHistory(dir string, repo string, repoDir string) {
+	if !isGitRepo(dir, repoDir) {
+		fmt.Fprintf(os.Stderr, "Skipping %s, as it is not a git repo\n", repo)
+	} else if history.IsShallow(repoDir) {
+		fmt.Fprintf(os.Stderr, "%s is a shallow clone, so references may appear to have been introduced by its"+
+			" oldest commit; run `git fetch --unshallow` in it to fetch its full history\n", repo)
+	}
+}
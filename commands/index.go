@@ -0,0 +1,217 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/andykuszyk/depgrok/index"
+	"github.com/andykuszyk/depgrok/search"
+	"github.com/urfave/cli"
+)
+
+// The main function for the index command - walks a directory of repos, tokenising each
+// file into an inverted index that is written to disk for use by the query command.
+//
+// If the index already exists, it is updated incrementally: files that have not changed
+// since they were last indexed (judged by their git blob hashes, or modification times and
+// sizes for files outside of git) have their tokens carried over rather than being read again.
+func Index(c *cli.Context) {
+	dir := c.String("dir")
+	indexPath := c.String("index")
+	if dir == "" || indexPath == "" {
+		log.Fatal("--dir and --index are required flags")
+	}
+	exclude := c.StringSlice("exclude")
+	include := c.StringSlice("include")
+	if len(exclude) > 0 && len(include) > 0 {
+		log.Fatal("--exclude cannot be used in conjunction with --include")
+	}
+	debug := c.Bool("debug")
+
+	defer logDuration(time.Now(), "Total time")
+
+	builder := index.NewBuilder()
+	previousFiles := map[string]int{}
+	var previous []index.File
+	if _, err := os.Stat(indexPath); err == nil && !c.Bool("full") {
+		idx, err := index.Open(indexPath)
+		if err != nil {
+			log.Fatalf("Error opening existing index (use --full to rebuild it): %v", err)
+		}
+		defer idx.Close()
+		previous, err = idx.Files()
+		if err != nil {
+			log.Fatalf("Error reading existing index (use --full to rebuild it): %v", err)
+		}
+		for id, file := range previous {
+			previousFiles[file.Path] = id
+		}
+		builder = index.NewUpdateBuilder(idx)
+	}
+
+	hashesByRepo := map[string]map[string]string{}
+	repoDirs := map[string]string{}
+	indexed := 0
+	carried := 0
+	repoDepth, repoMarkers := repoOptions(c)
+	walkOptions := search.WalkOptions{
+		Exclude:     exclude,
+		Include:     include,
+		RepoDepth:   repoDepth,
+		RepoMarkers: repoMarkers,
+	}
+	err := search.Walk(dir, walkOptions, func(repo string, path string, info os.FileInfo) error {
+		// Git blob hashes are collected a repo at a time, along with the directory of the
+		// repo, the first time a file from the repo is found.
+		hashes, ok := hashesByRepo[repo]
+		if !ok {
+			repoDir := search.RepoDir(dir, repo, walkOptions)
+			repoDirs[repo] = repoDir
+			if isGitRepo(dir, repoDir) {
+				var err error
+				hashes, err = gitBlobHashes(repoDir)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error reading git hashes for %s, falling back to modification times: %v\n", repo, err)
+				}
+			}
+			hashesByRepo[repo] = hashes
+		}
+
+		file := index.File{
+			Repo:    repo,
+			Path:    path,
+			InRepo:  relativePath(repoDirs[repo], path),
+			ModTime: info.ModTime().UnixNano(),
+			Size:    info.Size(),
+			Hash:    hashes[path],
+		}
+		if id, ok := previousFiles[path]; ok && file.Unchanged(previous[id]) {
+			carried++
+			file.Definitions = previous[id].Definitions
+			return builder.Carry(file, id)
+		}
+
+		indexed++
+		if debug {
+			fmt.Fprintln(os.Stderr, path)
+		} else {
+			fmt.Fprintf(os.Stderr, "\rIndexing files: %d (%d unchanged)", indexed, carried)
+		}
+		return addToIndex(builder, file, path)
+	})
+	if err != nil {
+		log.Fatalf("Error indexing %s: %v", dir, err)
+	}
+	if err := builder.Write(indexPath); err != nil {
+		log.Fatalf("Error writing index to %s: %v", indexPath, err)
+	}
+	fmt.Fprintf(os.Stderr, "\rIndexed %d files, %d of which were unchanged", indexed+carried, carried)
+}
+
+// Tokenises the file at path into the index, along with the names of the entities it
+// defines, which are extracted from it as per the search command, where an Extractor is
+// registered for its extension and it is no longer than search.MaxExtractSize.
+func addToIndex(builder *index.Builder, file index.File, path string) error {
+	if extractor := search.ExtractorFor(filepath.ToSlash(path)); extractor != nil && file.Size <= search.MaxExtractSize {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		file.Definitions = extractor(contents)
+		return builder.Add(file, bytes.NewReader(contents))
+	}
+	reader, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return builder.Add(file, reader)
+}
+
+// The main function for the query command - resolves dependencies of the required depth
+// against an index written by the index command, rather than searching the files themselves,
+// and formats them for output on the console in the same way as the search command.
+func Query(c *cli.Context) {
+	depsArg := c.String("deps")
+	indexPath := c.String("index")
+	depth := c.Int("depth")
+	if depsArg == "" || indexPath == "" {
+		log.Fatal("--deps and --index are required flags")
+	}
+	if depth < 0 {
+		log.Fatal("--depth cannot be negative")
+	}
+	maxDepth := c.Int("max-depth")
+	if maxDepth < 0 {
+		log.Fatal("--max-depth cannot be negative")
+	}
+	if maxDepth == 0 {
+		maxDepth = search.DefaultMaxDepth
+	}
+
+	defer logDuration(time.Now(), "Total time")
+
+	idx, err := index.Open(indexPath)
+	if err != nil {
+		log.Fatalf("Error opening index: %v", err)
+	}
+	defer idx.Close()
+
+	result := search.NewResult(strings.Fields(depsArg))
+	result.NameFilter = nameFilter(c)
+	if err := resolve(idx, result, depth, maxDepth, c.Bool("file-names-only")); err != nil {
+		log.Fatal(err)
+	}
+
+	logLevels(result)
+	fmt.Println("")
+	printResult(c.String("format"), result)
+}
+
+// Resolves the dependencies of the result level by level against the index, up to the
+// given depth, in the same way as a search. A depth of 0 resolves level after level until
+// no new dependencies are found, up to the maximum depth. Files found to reference a
+// dependency become dependencies in turn by the entities they define, as recorded in the
+// index, or by their names alone if fileNamesOnly is true.
+func resolve(idx *index.Index, result *search.Result, depth int, maxDepth int, fileNamesOnly bool) error {
+	limit := depth
+	if depth == 0 {
+		limit = maxDepth
+	}
+	for level := 0; ; level++ {
+		levelDependencies := result.LevelDependencies(level)
+		if len(levelDependencies) == 0 {
+			return nil
+		}
+		if level == limit {
+			result.Truncated = depth == 0
+			return nil
+		}
+		result.Levels++
+		for _, dep := range levelDependencies {
+			locations, err := idx.Lookup(dep.Name)
+			if err != nil {
+				return fmt.Errorf("error looking up %s in the index: %v", dep.Name, err)
+			}
+			for _, location := range locations {
+				var definitions []string
+				if !fileNamesOnly {
+					definitions = location.Definitions
+				}
+				result.RecordReference(search.Reference{
+					Dependency: dep,
+					Repo:       location.Repo,
+					Path:       location.Path,
+					File:       location.InRepo,
+					Line:       location.Line,
+				}, definitions)
+			}
+		}
+	}
+}
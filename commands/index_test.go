@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/andykuszyk/depgrok/index"
+	"github.com/andykuszyk/depgrok/search"
+)
+
+func TestResolve_ShouldFindTheSameDependenciesAsASearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "depgrok-query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"db/deploy_042.sql":   "CREATE PROCEDURE dbo.usp_GetOrders AS\nSELECT * FROM orders\n",
+		"api/OrderService.cs": "public class OrderService {\n  void Get() { db.Execute(\"usp_GetOrders\"); }\n}\n",
+		"web/app.js":          "const service = new OrderService();\n",
+		"ops/notes.txt":       "On Friday, deploy_042 goes out\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, fileNamesOnly := range []bool{false, true} {
+		searcher, err := search.NewSearcher(search.Options{Roots: []string{dir}, Seeds: []string{"orders"}, Depth: 3, FileNamesOnly: fileNamesOnly})
+		if err != nil {
+			t.Fatal(err)
+		}
+		searched, err := searcher.Search()
+		if err != nil {
+			t.Fatalf("Unexpected error searching: %v", err)
+		}
+
+		builder := index.NewBuilder()
+		err = search.Walk(dir, search.WalkOptions{}, func(repo string, path string, info os.FileInfo) error {
+			file := index.File{Repo: repo, Path: path, InRepo: relativePath(filepath.Join(dir, repo), path), Size: info.Size()}
+			return addToIndex(builder, file, path)
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error indexing: %v", err)
+		}
+		indexPath := filepath.Join(dir, "depgrok.index")
+		if err := builder.Write(indexPath); err != nil {
+			t.Fatal(err)
+		}
+		idx, err := index.Open(indexPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queried := search.NewResult([]string{"orders"})
+		err = resolve(idx, queried, 3, search.DefaultMaxDepth, fileNamesOnly)
+		idx.Close()
+		os.Remove(indexPath)
+		if err != nil {
+			t.Fatalf("Unexpected error querying: %v", err)
+		}
+
+		if !reflect.DeepEqual(searched.Diagrams(), queried.Diagrams()) {
+			t.Errorf("Expected the query to find %v, as the search did with fileNamesOnly %v, but it found %v", searched.Diagrams(), fileNamesOnly, queried.Diagrams())
+		}
+		if len(searched.Diagrams()) < 2 {
+			t.Errorf("Expected the search to find chains through the definitions or file names, but it found %v", searched.Diagrams())
+		}
+	}
+}
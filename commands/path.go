@@ -0,0 +1,121 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/andykuszyk/depgrok/deps"
+	"github.com/andykuszyk/depgrok/search"
+	"github.com/urfave/cli"
+)
+
+// The main function for the path command - searches a directory of repos for
+// dependencies, as per the search command, then reports the shortest chain of references
+// from a repo to a dependency, along with the file responsible for each hop. With --all,
+// every chain of up to --max-length hops is reported instead.
+func Path(c *cli.Context) {
+	from := c.String("from")
+	to := c.String("to")
+	if from == "" || to == "" {
+		log.Fatal("--from and --to are required flags")
+	}
+	// The dependency being traced is searched for by default, unless it is given by the
+	// Key of an intermediate dependency (e.g. repo1:Orders.sql:Orders), which can only be
+	// found by searching for the dependencies it leads to.
+	if c.String("deps") == "" {
+		if name, _ := deps.ParseDependency(to); strings.Contains(name, ":") {
+			log.Fatalf("--deps is required when --to is the key of an intermediate dependency, as %s is", to)
+		}
+		c.Set("deps", to)
+	}
+	options := searchOptions(c)
+	dir := c.String("dir")
+	options.Roots = []string{dir}
+
+	defer logDuration(time.Now(), "Total time")
+
+	searcher, err := search.NewSearcher(options)
+	if err != nil {
+		log.Fatal(err)
+	}
+	result, err := searcher.Search()
+	if err != nil {
+		log.Fatalf("Error searching %s: %v", dir, err)
+	}
+	logLevels(result)
+	fmt.Fprintln(os.Stderr, "")
+
+	paths := []search.Path{}
+	if c.Bool("all") {
+		paths = result.AllPaths(from, to, c.Int("max-length"))
+	} else if path, ok := result.ShortestPath(from, to); ok {
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		fmt.Fprintf(os.Stderr, "No chain of references from %s to %s was found\n", from, to)
+	}
+	printPaths(c.String("format"), dir, paths)
+}
+
+// Represents a hop along a path as it is printed as JSON.
+type jsonHop struct {
+	Dependency string `json:"dependency"`
+	Path       string `json:"path"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+}
+
+// Prints the paths in the given format: text, which shows each path as a chain, followed
+// by the location of the reference responsible for each hop, or json.
+func printPaths(format string, dir string, paths []search.Path) {
+	switch format {
+	case "json":
+		output := [][]jsonHop{}
+		for _, path := range paths {
+			hops := []jsonHop{}
+			for _, hop := range path.Hops {
+				hops = append(hops, jsonHop{
+					Dependency: hop.Dependency.Key(),
+					Path:       relativePath(dir, hop.Path),
+					Line:       hop.Line,
+					Column:     hop.Column,
+				})
+			}
+			output = append(output, hops)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(output); err != nil {
+			log.Fatalf("Error writing the paths as JSON: %v", err)
+		}
+	case "", "text":
+		for _, path := range paths {
+			names := []string{path.Repo}
+			for _, dep := range path.Dependencies() {
+				names = append(names, dep.DisplayName())
+			}
+			fmt.Println(strings.Join(names, " -> "))
+			for _, hop := range path.Hops {
+				fmt.Printf("    %s:%d references %s\n", relativePath(dir, hop.Path), hop.Line, hop.Dependency.Name)
+			}
+		}
+	default:
+		log.Fatalf("--format must be text or json, but was %s", format)
+	}
+}
+
+// Returns the slash-separated path of the file at path relative to dir, or path itself if
+// it is not within dir.
+func relativePath(dir string, path string) string {
+	relative, err := filepath.Rel(dir, path)
+	if err != nil || strings.HasPrefix(relative, "..") {
+		return path
+	}
+	return filepath.ToSlash(relative)
+}
@@ -1,28 +1,19 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
-	"path/filepath"
-	"runtime"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
-	"regexp"
 
-	"github.com/andykuszyk/depgrok/deps"
+	"github.com/andykuszyk/depgrok/sarif"
+	"github.com/andykuszyk/depgrok/search"
 	"github.com/urfave/cli"
 )
 
-// Returns true if the given parent is a valid candidate for a search,
-// otherwise false is returned (e.g. in the case of a filename beginning
-// with ".".
-func isValidParent(parent string) bool {
-	return !(strings.HasPrefix(parent, ".") || parent == "bin" || parent == "obj")
-}
-
 var secondsBetweenLoadingChars = 1.0
 func getNextLoadingCharFunc() func() string {
 	char := "|"
@@ -52,214 +43,130 @@ func getNextLoadingCharFunc() func() string {
 
 var getNextLoadingChar = getNextLoadingCharFunc()
 
-// Gets a FileInfo for the given path, returning it if successful, or
-// logging a fatal error if not.
-func getFileInfo(path string) os.FileInfo {
-	fileInfo, err := os.Stat(path)
-	if err != nil {
-		log.Fatalf("An error occured calling os.Stat(%s): %v", path, err)
-	}
-	return fileInfo
+func logDuration(start time.Time, msg string) {
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintf(os.Stderr, "%s: %v", msg, time.Now().Sub(start).Seconds())
+	fmt.Fprintln(os.Stderr, "")
 }
 
-// Controls whether or not searches of the file system will be parallelised.
-// By default, this is true, although it can be set to false in tests to allow
-// go routines to be debugged.
-var paralleliseSearches = true
+type repoCount struct {
+	Count int
+	Level int
+	Path string
+}
 
-func matchGlob(path string, globs []string) []string {
-	globMatches := []string{}
-	for _, glob := range globs {
-		matches, err := filepath.Glob(filepath.Join(path, glob))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "An error occured handling the glob (%s): %v", glob, err)
-			continue
+func logRepos(repos chan repoCount, debug bool) {
+	repoCountByLevel := map[int]int{}
+	for {
+		repoCount, _ := <-repos
+		repoCountByLevel[repoCount.Level] += repoCount.Count
+		if debug {
+			fmt.Fprintln(os.Stderr, repoCount.Path)
+		} else {
+			fmt.Fprintf(os.Stderr, "\rSearching level %d files: %d", repoCount.Level, repoCountByLevel[repoCount.Level])
 		}
-		globMatches = append(globMatches, matches...)
 	}
-	return globMatches
 }
 
-// Iterates over the children of a given parent path, calling searchChildren as a 
-// go routine on each.
-func traverseChildren(
-	parent string,
-	dependencies *deps.Dependencies,
-	level int,
-	wg *sync.WaitGroup,
-	repo string,
-	exclude []string,
-	include []string,
-	repos chan repoCount) {
-	children, err := ioutil.ReadDir(parent)
-	if err != nil {
-		log.Fatalf("An error occured calling ioutil.ReadDir(%s): %v", parent, err)
-	}
-
-	// See if any of the children in this parent match the exclusions provided, by first
-	// building up a list of files to exclude.
-	excludeMatches := matchGlob(parent, exclude)
-
-	// Traverse the children of the parent, making a recursive call to searchChildren
-	// if its a valid child.
-	for _, child := range children {
-		// First, check that the file name is a valid one for searching.
-		if !isValidParent(child.Name()) {
-			continue
-		}
-
-		// Then, check that the file is not supposed to be excluded by one of the provided
-		// globs.
-		excludeFile := false
-		for _, excludeMatch := range excludeMatches {
-			if filepath.Join(parent, child.Name()) == excludeMatch {
-				excludeFile = true
-				break
-			}
-		}
-		if excludeFile {
-			continue
+// Parses rules given as glob=matcher, e.g. *.sql=sql, into search.MatcherRules.
+func parseMatcherRules(rules []string) ([]search.MatcherRule, error) {
+	matcherRules := []search.MatcherRule{}
+	for _, rule := range rules {
+		i := strings.LastIndex(rule, "=")
+		if i <= 0 || i == len(rule)-1 {
+			return nil, fmt.Errorf("--matcher-for must be given as glob=matcher, but was %s", rule)
 		}
+		matcherRules = append(matcherRules, search.MatcherRule{Glob: rule[:i], Matcher: rule[i+1:]})
+	}
+	return matcherRules, nil
+}
 
-		// If this is the first traversal of the root directory, no repo name will have been
-		// provided, so extract this from the child's name.
-		newRepo := repo
-		if newRepo == "" {
-			newRepo = child.Name()
-		}
-		if paralleliseSearches {
-			go searchChildren(newRepo, filepath.Join(parent, child.Name()), dependencies, level, wg, exclude, include, repos)
-		} else {
-			searchChildren(newRepo, filepath.Join(parent, child.Name()), dependencies, level, wg, exclude, include, repos)
+// Parses a unit given as repo, module or directory:N, returning the repo depth or markers
+// that divide the files searched into units of that kind.
+func parseUnit(unit string) (int, []string, error) {
+	switch {
+	case unit == "" || unit == "repo":
+		return 0, nil, nil
+	case unit == "module":
+		return 0, search.ModuleMarkers, nil
+	case strings.HasPrefix(unit, "directory:"):
+		depth, err := strconv.Atoi(strings.TrimPrefix(unit, "directory:"))
+		if err != nil || depth < 1 {
+			return 0, nil, fmt.Errorf("--unit directory:N must be given a positive number of directories, but was %s", unit)
 		}
+		return depth, nil, nil
 	}
+	return 0, nil, fmt.Errorf("--unit must be repo, module or directory:N, but was %s", unit)
 }
 
-// Searches the file at the path parent for references to the given dependencies,
-// updating or augmenting the dependencies list as and when matches are found.
-func searchFile(parent string, repo string, dependencies *deps.Dependencies, parentInfo os.FileInfo, level int) {
-	// Interrogate the file - read its contents out as a string.
-	bytes, err := ioutil.ReadFile(parent)
+// Returns the repo depth and markers given by the --unit, --repo-depth and --repo-markers
+// flags, exiting if they are invalid or conflict.
+func repoOptions(c *cli.Context) (int, []string) {
+	depth, markers, err := parseUnit(c.String("unit"))
 	if err != nil {
-		log.Fatalf("Error reading file %s: %v", parent, err)
+		log.Fatal(err)
 	}
-	text := string(bytes)
-
-	// Now, iterate though each of the dependencies at the current level (in order avoid
-	// worrying about new dependencies of a higher level that have been collected on this pass)
-	// and check for a reference within the file.
-	for _, dep := range dependencies.Slice() {
-		if dep.Level != level {
-			continue
-		}
-		if stripExtension(parentInfo.Name()) != dep.Name && dep.Matches(text) {
-			dep.AddRepo(repo)
-			parentDependency := deps.Dependency{
-				Name:   stripExtension(parentInfo.Name()),
-				Parent: dep,
-				Level:  level + 1,
-			}
-			if !dependencies.Contains(parentDependency) {
-				dependencies.Add(&parentDependency)
-			}
+	if c.Int("repo-depth") < 0 {
+		log.Fatal("--repo-depth cannot be negative")
+	}
+	if c.Int("repo-depth") > 0 {
+		if depth > 0 {
+			log.Fatal("--repo-depth cannot be used in conjunction with --unit directory:N")
 		}
+		depth = c.Int("repo-depth")
 	}
+	return depth, append(append([]string{}, markers...), c.StringSlice("repo-markers")...)
 }
 
-// Recursively searches a file tree, amending and augmenting dependencies (at the given
-// level) as matches are discovered.
-func searchChildren(
-	repo string,
-	parent string,
-	dependencies *deps.Dependencies,
-	level int,
-	wg *sync.WaitGroup,
-	exclude []string,
-	include []string,
-	repos chan repoCount) {
-	// Ensure that we add a counter to the waitgroup for this function call,
-	// and also wait on the "semaphore" channel to ensure too many parallel
-	// executions of this function are not taking place.
-	wg.Add(1)
-	defer wg.Done()
-	sem <- 1
-	releaseSem := func() {
-		<-sem
+// Returns the search.NameFilter given by the --stop-name, --no-default-stop-names,
+// --min-name-length and --min-name-entropy flags.
+func nameFilter(c *cli.Context) search.NameFilter {
+	filter := search.DefaultNameFilter()
+	if c.Bool("no-default-stop-names") {
+		filter.StopList = nil
 	}
-	defer releaseSem()
+	filter.StopList = append(append([]string{}, filter.StopList...), c.StringSlice("stop-name")...)
+	filter.MinLength = c.Int("min-name-length")
+	filter.MinEntropy = c.Float64("min-name-entropy")
+	return filter
+}
 
-	// First, check if the parent location is a directory. If it is, traverse its children, if not
-	// interrogate its contents.
-	parentInfo := getFileInfo(parent)
-	if parentInfo.IsDir() {
-		repos <- repoCount{Level: level, Count: 1, Path: parent}
-		traverseChildren(parent, dependencies, level, wg, repo, exclude, include, repos)
-	} else {
-		// Also, check that the file is supposed to be included.
-		if len(include) > 0 {
-			includeMatches := matchGlob(filepath.Dir(parent), include)
-			for _, includeMatch := range includeMatches {
-				if parent == includeMatch {
-					repos <- repoCount{Level: level, Count: 1, Path: parent}
-					searchFile(parent, repo, dependencies, parentInfo, level)
-				}
-			}
-		} else {
-			repos <- repoCount{Level: level, Count: 1, Path: parent}
-			searchFile(parent, repo, dependencies, parentInfo, level)
-		}
+// Returns the search depth given by --depth, where 0 searches until no new dependencies
+// are found.
+func searchDepth(depth int) int {
+	if depth == 0 {
+		return search.UnlimitedDepth
 	}
+	return depth
 }
 
-// A closed function encapsulating the regexp to strip extensions from
-// file names.
-func stripExtensionFunc() func(string) string {
-	stripExtensionRegexp, err := regexp.Compile("(.*)\\.[a-zA-Z]+$")
-	if err != nil {
-		log.Fatalf("Error parsing strip extension regex: %v", err)
+// Returns the CacheBudget for a --cache-mb flag, for which 0 means that no file contents
+// are held in memory.
+func cacheBudget(megabytes int) int64 {
+	if megabytes < 0 {
+		log.Fatal("--cache-mb cannot be negative")
 	}
-	return func(filename string) string {
-		return stripExtensionRegexp.ReplaceAllString(filename, "$1")
+	if megabytes == 0 {
+		return search.NoCache
 	}
+	return int64(megabytes) * 1024 * 1024
 }
 
-// Strips extensions from file names.
-var stripExtension = stripExtensionFunc()
-
-func logDuration(start time.Time, msg string) {
-	fmt.Fprintln(os.Stderr, "")
-	fmt.Fprintf(os.Stderr, "%s: %v", msg, time.Now().Sub(start).Seconds())
-	fmt.Fprintln(os.Stderr, "")
-}
-
-var sem = make(chan int, runtime.NumCPU()*2)
-
-type repoCount struct {
-	Count int
-	Level int
-	Path string
-}
-
-func logRepos(repos chan repoCount, debug bool) {
-	repoCountByLevel := map[int]int{}
-	for {
-		repoCount, _ := <-repos
-		repoCountByLevel[repoCount.Level] += repoCount.Count
-		if debug {
-			fmt.Fprintln(os.Stderr, repoCount.Path)
-		} else {
-			fmt.Fprintf(os.Stderr, "\rSearching level %d files: %d", repoCount.Level, repoCountByLevel[repoCount.Level])
-		}
+// Reports the number of levels searched on stderr, warning if the search was stopped by
+// --max-depth before all of the dependencies found had been searched for.
+func logLevels(result *search.Result) {
+	fmt.Fprintf(os.Stderr, "\nNumber of levels searched: %d", result.Levels)
+	if result.Truncated {
+		fmt.Fprintf(os.Stderr, "\nStopped after %d levels with dependencies still to search for;"+
+			" raise --max-depth to search further", result.Levels)
 	}
 }
 
-// The main function for the search command - setups up concurrency primitives and
-// initiates a search of the required depth, collecting depdencies and formating
-// them for output on the console.
-func Search(c *cli.Context) {
+// Builds the options for a search.Searcher from the flags shared by the search and history
+// commands, exiting if any of them are invalid. Roots are left for the caller to set.
+func searchOptions(c *cli.Context) search.Options {
 	depsArg := c.String("deps")
 	dir := c.String("dir")
-	depth := c.Int("depth")
 	if dir == "" || depsArg == "" {
 		log.Fatal("--deps and --dir are required flags")
 	}
@@ -268,30 +175,122 @@ func Search(c *cli.Context) {
 	if len(exclude) > 0 && len(include) > 0 {
 		log.Fatal("--exclude cannot be used in conjunction with --include")
 	}
+	matcherRules, err := parseMatcherRules(c.StringSlice("matcher-for"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	repoDepth, repoMarkers := repoOptions(c)
+	filter := nameFilter(c)
+	return search.Options{
+		Seeds:         strings.Fields(depsArg),
+		Depth:         searchDepth(c.Int("depth")),
+		MaxDepth:      c.Int("max-depth"),
+		Exclude:       exclude,
+		Include:       include,
+		Archives:      c.Bool("archives"),
+		RepoDepth:     repoDepth,
+		RepoMarkers:   repoMarkers,
+		Matcher:       c.String("matcher"),
+		MatcherRules:  matcherRules,
+		NameFilter:    &filter,
+		FileNamesOnly: c.Bool("file-names-only"),
+		Workers:       c.Int("workers"),
+		CacheBudget:   cacheBudget(c.Int("cache-mb")),
+	}
+}
+
+// The main function for the search command - configures a search.Searcher from the
+// command's flags and runs a search of the required depth, formatting the dependencies
+// found for output on the console.
+func Search(c *cli.Context) {
+	options := searchOptions(c)
+	dir := c.String("dir")
 	debug := c.Bool("debug")
 
 	// Record the time now and defer a timer until after execution is complete.
 	defer logDuration(time.Now(), "Total time")
 
-	// Construct list of dependencies and collect repo relationships
-	// by searching children.
-	wg := sync.WaitGroup{}
-	dependencies := deps.BuildDependencies(strings.Fields(depsArg))
+	// Search for dependencies, reporting progress on stderr.
 	repos := make(chan repoCount)
 	go logRepos(repos, debug)
+	options.Progress = func(level int, path string) {
+		repos <- repoCount{Level: level, Count: 1, Path: path}
+	}
+	if ref := c.String("ref"); ref != "" {
+		refs, closeRefs, err := openRefs(dir, ref, options.RepoDepth)
+		if err != nil {
+			log.Fatalf("Error opening %s in the repos in %s: %v", ref, dir, err)
+		}
+		defer closeRefs()
+		if len(refs) == 0 {
+			log.Fatalf("%s could not be found in any of the repos in %s", ref, dir)
+		}
+		options.Repos = refs
+	} else {
+		options.Roots = []string{dir}
+	}
+	searcher, err := search.NewSearcher(options)
+	if err != nil {
+		log.Fatal(err)
+	}
 	start := time.Now()
-	for i := 0; i < depth; i++ {
-		searchChildren("", dir, dependencies, i, &wg, exclude, include, repos)
-		wg.Wait()
-		fmt.Fprintf(os.Stderr, "Number of dependencies after pass %d: %d", i, dependencies.Len())
+	result, err := searcher.Search()
+	if err != nil {
+		log.Fatalf("Error searching %s: %v", dir, err)
+	}
+	fmt.Fprintf(os.Stderr, "\nNumber of dependencies found: %d", result.Dependencies.Len())
+	logLevels(result)
+	logDuration(start, "Search")
+	if path := c.String("save"); path != "" {
+		if err := search.SaveSnapshot(path, result.Report()); err != nil {
+			log.Fatalf("Error saving a snapshot to %s: %v", path, err)
+		}
 	}
-	logDuration(start, "SearchChildren")
 
 	// Print out diagrams to screen in a reasonable order.
 	fmt.Println("")
 	start = time.Now()
-	for _, diagram := range dependencies.BuildDiagrams() {
-		fmt.Println(diagram.Text)
-	}
+	printResult(c.String("format"), result)
 	logDuration(start, "BuildDiagrams")
 }
+
+// Prints the result of a search in the given format: text, which lists the diagrams of
+// the dependency chains found, followed by any cycles, json, which prints the
+// search.Report of the result, or sarif, which prints each reference as a SARIF result.
+func printResult(format string, result *search.Result) {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(result.Report()); err != nil {
+			log.Fatalf("Error writing the result as JSON: %v", err)
+		}
+	case "sarif":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(sarif.FromReport(result.Report())); err != nil {
+			log.Fatalf("Error writing the result as SARIF: %v", err)
+		}
+	case "", "text":
+		for _, diagram := range result.Diagrams() {
+			fmt.Println(diagram.Text)
+		}
+		cycles := result.Cycles()
+		if len(cycles) == 0 {
+			return
+		}
+		fmt.Println("")
+		fmt.Println("Cycles:")
+		for _, cycle := range cycles {
+			names := []string{}
+			for _, dep := range cycle {
+				names = append(names, dep.DisplayName())
+			}
+			fmt.Println(strings.Join(names, " -> "))
+		}
+	default:
+		log.Fatalf("--format must be text, json or sarif, but was %s", format)
+	}
+}
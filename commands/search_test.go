@@ -1,59 +1,12 @@
 package commands
 
 import (
+	"reflect"
 	"testing"
-	"sync"
-	"strings"
-	"path/filepath"
 
-	"github.com/andykuszyk/depgrok/deps"
+	"github.com/andykuszyk/depgrok/search"
 )
 
-func TestSearchChildren_ShouldFindSimpleDependency(t *testing.T) {
-	paralleliseSearches = false
-	wg := sync.WaitGroup{}
-	dependencies := deps.BuildDependencies(strings.Fields("dependency1"))
-	searchChildren("", filepath.Join("..", "testdata"), dependencies, 0, &wg, []string{"*.md"}, []string{}, make(chan repoCount, 100))
-	wg.Wait()
-	slice := dependencies.Slice()
-	if len(slice) != 2 {
-		t.Errorf("Expected there to be 2 dependencies, but there were %d", len(slice))
-	}
-	var dependency *deps.Dependency
-	for _, dep := range slice {
-		if dep.Name == "dependency1" {
-			dependency = dep
-			break
-		}
-	}
-	if len(dependency.Repos) != 1 {
-		t.Errorf("There should have been 1 repo for the dependency, but there were %d", len(dependency.Repos))
-	}
-	if !dependency.Repos["repo1"] {
-		var key string
-		for k, _ := range dependency.Repos {
-			key = k
-			break
-		}
-		t.Errorf("The repo should have been repo1, but it was %s", key)
-	}
-}
-
-
-func TestStripExtension_WhenTwoExtensions(t *testing.T) {
-	result := stripExtension("file.txt.txt")
-	if result != "file.txt" {
-		t.Errorf("Expected file.txt, but got %s", result)
-	}
-}
-
-func TestStripExtension_WhenOneExtension(t *testing.T) {
-	result := stripExtension("file.txt")
-	if result != "file" {
-		t.Errorf("Expected file, but got %s", result)
-	}
-}
-
 func TestGetNextLoadingChar(t *testing.T) {
 	secondsBetweenLoadingChars = 0.0
 	char := getNextLoadingChar()
@@ -81,3 +34,46 @@ func TestGetNextLoadingChar(t *testing.T) {
 		t.Errorf("Expected /, but got %s", char)
 	}
 }
+
+func TestParseMatcherRules_ShouldSplitGlobsAndMatchers(t *testing.T) {
+	rules, err := parseMatcherRules([]string{"*.sql=sql", "*.cs=token"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []search.MatcherRule{{Glob: "*.sql", Matcher: "sql"}, {Glob: "*.cs", Matcher: "token"}}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Expected %v, but got %v", expected, rules)
+	}
+}
+
+func TestParseMatcherRules_ShouldReturnErrorForInvalidRule(t *testing.T) {
+	for _, rule := range []string{"*.sql", "=sql", "*.sql="} {
+		if _, err := parseMatcherRules([]string{rule}); err == nil {
+			t.Errorf("Expected an error for %s", rule)
+		}
+	}
+}
+
+func TestParseUnit_ShouldReturnRepoOptions(t *testing.T) {
+	depth, markers, err := parseUnit("repo")
+	if err != nil || depth != 0 || markers != nil {
+		t.Errorf("Expected repos to be detected by default, but got %d, %v, %v", depth, markers, err)
+	}
+	depth, markers, err = parseUnit("module")
+	if err != nil || depth != 0 || !reflect.DeepEqual(markers, search.ModuleMarkers) {
+		t.Errorf("Expected modules to be detected by their markers, but got %d, %v, %v", depth, markers, err)
+	}
+	depth, markers, err = parseUnit("directory:2")
+	if err != nil || depth != 2 || markers != nil {
+		t.Errorf("Expected a repo depth of 2, but got %d, %v, %v", depth, markers, err)
+	}
+}
+
+func TestParseUnit_ShouldReturnErrorForInvalidUnit(t *testing.T) {
+	for _, unit := range []string{"package", "directory", "directory:", "directory:0", "directory:x"} {
+		if _, _, err := parseUnit(unit); err == nil {
+			t.Errorf("Expected an error for %s", unit)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/andykuszyk/depgrok/search"
+	"github.com/urfave/cli"
+)
+
+// The main function for the stats command - searches a directory of repos for
+// dependencies, as per the search command, then reports the number of repos that reach
+// each seed, followed by every dependency found, ranked by how central it is to the graph.
+func Stats(c *cli.Context) {
+	options := searchOptions(c)
+	dir := c.String("dir")
+	options.Roots = []string{dir}
+
+	defer logDuration(time.Now(), "Total time")
+
+	searcher, err := search.NewSearcher(options)
+	if err != nil {
+		log.Fatal(err)
+	}
+	result, err := searcher.Search()
+	if err != nil {
+		log.Fatalf("Error searching %s: %v", dir, err)
+	}
+	logLevels(result)
+	fmt.Fprintln(os.Stderr, "")
+
+	stats := result.Stats()
+	ranked := stats
+	if top := c.Int("top"); top > 0 && top < len(stats) {
+		ranked = stats[:top]
+	}
+	printStats(c.String("format"), stats, ranked)
+}
+
+// Represents the stats of a dependency as they are printed as JSON.
+type jsonStats struct {
+	Rank            int    `json:"rank"`
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	Level           int    `json:"level"`
+	Repos           int    `json:"repos"`
+	TransitiveRepos int    `json:"transitiveRepos"`
+	Dependents      int    `json:"dependents"`
+	FanIn           int    `json:"fanIn"`
+	FanOut          int    `json:"fanOut"`
+}
+
+// Prints the ranked stats in the given format: text, which shows the repos reached by
+// each seed (taken from all), followed by a table of the ranking, or json.
+func printStats(format string, all []search.DependencyStats, ranked []search.DependencyStats) {
+	switch format {
+	case "json":
+		output := []jsonStats{}
+		for i, s := range ranked {
+			output = append(output, jsonStats{
+				Rank:            i + 1,
+				ID:              s.Dependency.Key(),
+				Name:            s.Dependency.Name,
+				Level:           s.Dependency.Level,
+				Repos:           s.Repos,
+				TransitiveRepos: s.TransitiveRepos,
+				Dependents:      s.Dependents,
+				FanIn:           s.FanIn,
+				FanOut:          s.FanOut,
+			})
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(output); err != nil {
+			log.Fatalf("Error writing the stats as JSON: %v", err)
+		}
+	case "", "text":
+		fmt.Println("Seeds:")
+		for _, s := range all {
+			if s.Dependency.Level == 0 {
+				fmt.Printf("%s is referenced by %d repos directly, and %d transitively\n",
+					s.Dependency.Name, s.Repos, s.TransitiveRepos)
+			}
+		}
+		fmt.Println("")
+		fmt.Println("Ranking:")
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "RANK\tDEPENDENCY\tREPOS\tTRANSITIVE REPOS\tDEPENDENTS\tFAN-IN\tFAN-OUT")
+		for i, s := range ranked {
+			fmt.Fprintf(writer, "%d\t%s\t%d\t%d\t%d\t%d\t%d\n", i+1, s.Dependency.DisplayName(),
+				s.Repos, s.TransitiveRepos, s.Dependents, s.FanIn, s.FanOut)
+		}
+		writer.Flush()
+	default:
+		log.Fatalf("--format must be text or json, but was %s", format)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"sort"
 	"sync"
-	"regexp"
 )
 
 // Represents a dependency that is being searched for, which might be related to
@@ -21,31 +20,66 @@ type Dependency struct {
 	Parent *Dependency
 	Repos  map[string]bool
 	Level  int
+	// The repo, and the path within the repo, of the file that an intermediate dependency
+	// (of a level greater than 0) was found in, which identify it amongst any other
+	// dependencies of the same name. Both are empty for the dependencies searched for
+	// initially.
+	Repo string
+	Path string
+	// The name of the registered Matcher used to find references to the Dependency, or
+	// empty if it should be found using the default for the search.
+	Matcher string
 	mutex sync.Mutex
-	regexp *regexp.Regexp
+	matcher Matcher
+}
+
+// Returns the identity of the Dependency within a Dependencies collection: its name,
+// qualified by the repo and path of its file for an intermediate dependency. Intermediate
+// dependencies of the same name, such as Orders.sql in one repo and Orders.cs in another,
+// are therefore kept apart, although they are still found by their shared name, as are the
+// several entities that might be defined by a single file.
+func (d *Dependency) Key() string {
+	if d.Path == "" {
+		return d.Name
+	}
+	return d.Repo + ":" + d.Path + ":" + d.Name
+}
+
+// Returns the name of the Dependency as it is displayed in diagrams, which is qualified
+// by the repo of its file for an intermediate dependency, e.g. repo1:Orders.
+func (d *Dependency) DisplayName() string {
+	if d.Repo == "" {
+		return d.Name
+	}
+	return d.Repo + ":" + d.Name
 }
 
 // Adds a new repo to a Dependency's Repos map, setting its mapped value to true,
 // which allows the Repos map to be used as a set.
 func (d *Dependency) AddRepo(repo string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 	if d.Repos == nil {
 		d.Repos = make(map[string]bool)
 	}
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
 	d.Repos[repo] = true
 }
 
-// Determines whether or not the Dependency is referenced in the given text.
+// Determines whether or not the Dependency is referenced in the given text, using its
+// Matcher, or interpreting its name as a regular expression if it does not have one.
 func (d *Dependency) Matches(text string) bool {
-	if d.regexp == nil {
-		r, err := regexp.Compile(fmt.Sprintf("[^a-zA-Z]%s[^a-zA-Z]", d.Name))
+	if d.matcher == nil {
+		name := d.Matcher
+		if name == "" {
+			name = "regex"
+		}
+		m, err := NewMatcher(name, []*Dependency{d})
 		if err != nil {
 			return false
 		}
-		d.regexp = r
+		d.matcher = m
 	}
-	return d.regexp.FindString(text) != ""
+	return len(d.matcher.FindAll(text)) > 0
 }
 
 // Represents a diagram illustrating the relationship between a Dependency and
@@ -60,12 +94,12 @@ type DependencyDiagram struct {
 // Constructs a DependencyDiagram from the information stored in a Dependency,
 // accounting for the information available via the ancestry of the Parent Dependency.
 func (d *Dependency) DependencyDiagram(repo string) DependencyDiagram {
-	text := fmt.Sprintf("%s -> %s", repo, d.Name)
+	text := fmt.Sprintf("%s -> %s", repo, d.DisplayName())
 	depName := d.Name
 	parent := d.Parent
 	for parent != nil {
 		depName = parent.Name
-		text = fmt.Sprintf("%s -> %s", text, parent.Name)
+		text = fmt.Sprintf("%s -> %s", text, parent.DisplayName())
 		parent = parent.Parent
 	}
 	return DependencyDiagram{
@@ -80,6 +114,9 @@ type dependencyDiagramKey struct {
 	Name string
 	Repo string
 	Level int
+	// The Key of the Dependency, which tells apart intermediate dependencies of the same
+	// name.
+	Key string
 }
 
 // Represents an array of `dependencyDiagramKey`s, which can be sorted using `sort.Sort()`.
@@ -91,7 +128,7 @@ func (k dependencyDiagramKeys) Len() int {
 }
 
 // Provides a `Less` implementation for `sort.Interface`, sorting keys
-// repo, name and level.
+// repo, name, level and key.
 func (k dependencyDiagramKeys) Less(i, j int) bool {
 	elementI := k[i]
 	elementJ := k[j]
@@ -109,7 +146,10 @@ func (k dependencyDiagramKeys) Less(i, j int) bool {
 		return false
 	}
 
-	return elementI.Level < elementJ.Level
+	if elementI.Level != elementJ.Level {
+		return elementI.Level < elementJ.Level
+	}
+	return elementI.Key < elementJ.Key
 }
 
 // Provides a `Swap` implementation for `sort.Interface`.
@@ -131,7 +171,7 @@ func (d *Dependencies) BuildDiagrams() []DependencyDiagram {
 	diagramsByKey := make(map[dependencyDiagramKey]DependencyDiagram)
 	for _, dep := range d.dependencies {
 		for repo, _ := range dep.Repos {
-			diagramsByKey[dependencyDiagramKey{Name: dep.Name, Repo: repo, Level: dep.Level}] = dep.DependencyDiagram(repo)
+			diagramsByKey[dependencyDiagramKey{Name: dep.Name, Repo: repo, Level: dep.Level, Key: dep.Key()}] = dep.DependencyDiagram(repo)
 		}
 	}
 
@@ -154,52 +194,81 @@ func (d *Dependencies) BuildDiagrams() []DependencyDiagram {
 type Dependencies struct {
 	dependencies map[string]*Dependency
 	membership   map[string]bool
+	ordered      []*Dependency
 	mutex        sync.Mutex
 }
 
-// Constructs a new Dependencies collection from the given list of dependency names.
+// Constructs a new Dependencies collection from the given list of dependency names, each
+// of which may name the Matcher used to find it, as per ParseDependency.
 func BuildDependencies(dependencies []string) *Dependencies {
 	deps := Dependencies{}
 	deps.membership = make(map[string]bool)
 	deps.dependencies = make(map[string]*Dependency)
 	for _, item := range dependencies {
+		name, matcher := ParseDependency(item)
 		deps.Add(&Dependency{
-			Name:  item,
-			Level: 0,
+			Name:    name,
+			Level:   0,
+			Matcher: matcher,
 		})
 	}
 	return &deps
 }
 
-// Returns a slice of the Dependency items currently held by this instance.
+// Returns a slice of the Dependency items currently held by this instance, in the order
+// in which they were added.
 func (d *Dependencies) Slice() []*Dependency {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 	s := []*Dependency{}
-	for _, v := range d.dependencies {
+	for _, v := range d.ordered {
 		s = append(s, v)
 	}
 	return s
 }
 
-// Returns true if a Dependency of the same Name as dep is already present in the
+// Returns true if a Dependency with the same Key as dep is already present in the
 // Dependencies collection.
-func (d *Dependencies) Contains(dep Dependency) bool {
+func (d *Dependencies) Contains(dep *Dependency) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.membership[dep.Key()]
+}
+
+// Returns the Dependency in the collection with the given Key, or nil if there is not one.
+func (d *Dependencies) Get(key string) *Dependency {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
-	return d.membership[dep.Name]
+	return d.dependencies[key]
+}
+
+// Returns the dependencies in the collection with the given name, in the order in which
+// they were added. There may be several intermediate dependencies of the same name, each
+// found in a different file.
+func (d *Dependencies) Named(name string) []*Dependency {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	named := []*Dependency{}
+	for _, dep := range d.ordered {
+		if dep.Name == name {
+			named = append(named, dep)
+		}
+	}
+	return named
 }
 
-// Adds the given Dependency to the collection, returning an error if it already exists
-// by name. Nil is returned if the Dependency is added successfully.
+// Adds the given Dependency to the collection, returning an error if one with the same
+// Key already exists. Nil is returned if the Dependency is added successfully.
 func (d *Dependencies) Add(dep *Dependency) error {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
-	if d.membership[dep.Name] {
-		return errors.New("The collection already contains a Dependency with this name")
+	key := dep.Key()
+	if d.membership[key] {
+		return errors.New("The collection already contains this Dependency")
 	}
-	d.membership[dep.Name] = true
-	d.dependencies[dep.Name] = dep
+	d.membership[key] = true
+	d.dependencies[key] = dep
+	d.ordered = append(d.ordered, dep)
 	return nil
 }
 
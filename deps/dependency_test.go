@@ -243,7 +243,7 @@ func TestDependenciesSlice_ShouldReturnSlice(t *testing.T) {
 func TestDependenciesContains_ShouldReturnTrueWhenDependencyExists(t *testing.T) {
 	sut := BuildDependencies([]string{"one", "two", "three"})
 
-	result := sut.Contains(Dependency{Name: "one"})
+	result := sut.Contains(&Dependency{Name: "one"})
 
 	if !result {
 		t.Error("Contains should return true when the dependency is contained within the collection")
@@ -253,7 +253,7 @@ func TestDependenciesContains_ShouldReturnTrueWhenDependencyExists(t *testing.T)
 func TestDependenciesContains_ShouldReturnFalseWhenDependencyNotExists(t *testing.T) {
 	sut := BuildDependencies([]string{"one", "two", "three"})
 
-	result := sut.Contains(Dependency{Name: "four"})
+	result := sut.Contains(&Dependency{Name: "four"})
 
 	if result {
 		t.Error("Contains should return false when the dependency is not contained within the collection")
@@ -267,10 +267,33 @@ func TestDependenciesAdd_ShouldAddToCollection(t *testing.T) {
 	if err != nil {
 		t.Error("No error should be returned when adding a new dependency")
 	}
-	if !sut.Contains(Dependency{Name: "two"}) {
+	if !sut.Contains(&Dependency{Name: "two"}) {
 		t.Error("Contains should return true for a Dependency that has been added using Add")
 	}
 	if !contains(sut.Slice(), "two") {
 		t.Error("Slice should return a new Dependency after it has been added with Add")
 	}
 }
+
+func TestDependenciesAdd_ShouldKeepIntermediateDependenciesOfSameNameApart(t *testing.T) {
+	sut := BuildDependencies([]string{"orders"})
+	sql := &Dependency{Name: "Orders", Repo: "repo1", Path: "repo1/Orders.sql", Level: 1}
+	cs := &Dependency{Name: "Orders", Repo: "repo2", Path: "repo2/Orders.cs", Level: 1}
+
+	assert.Nil(t, sut.Add(sql))
+	assert.Nil(t, sut.Add(cs))
+	assert.NotNil(t, sut.Add(&Dependency{Name: "Orders", Repo: "repo1", Path: "repo1/Orders.sql"}))
+
+	assert.True(t, sut.Contains(sql))
+	assert.False(t, sut.Contains(&Dependency{Name: "Orders", Repo: "repo3", Path: "repo3/Orders.sql"}))
+	assert.Equal(t, []*Dependency{sql, cs}, sut.Named("Orders"))
+}
+
+func TestDependencyDiagram_ShouldQualifyIntermediateDependenciesByRepo(t *testing.T) {
+	parent := Dependency{Name: "orders"}
+	sut := Dependency{Name: "Orders", Repo: "repo1", Path: "repo1/Orders.sql", Parent: &parent, Level: 1}
+
+	diagram := sut.DependencyDiagram("repo2")
+
+	assert.Equal(t, "repo2 -> repo1:Orders -> orders", diagram.Text)
+}
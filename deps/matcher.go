@@ -0,0 +1,193 @@
+package deps
+
+// Represents a single reference to a Dependency found in some text, with Start and End
+// being the byte offsets of the referenced name.
+type Match struct {
+	Dependency *Dependency
+	Start      int
+	End        int
+}
+
+// Finds references to a set of dependencies in some text.
+type Matcher interface {
+	// Returns every reference found in the given text.
+	FindAll(text string) []Match
+
+	// Returns the length of the longest reference the Matcher can find, which allows
+	// callers scanning text in chunks to carry enough of each chunk over to the next.
+	MaxLen() int
+}
+
+// Finds references to a set of dependencies in a single pass over some text, by compiling
+// their names into an Aho-Corasick automaton.
+//
+// By default, a reference is only found if it is surrounded by non-letter characters, and
+// names are matched literally, rather than being interpreted as regular expressions as
+// they are by RegexMatcher.
+type MultiMatcher struct {
+	dependencies []*Dependency
+
+	// Maps each byte to an equivalence class, so that the transition table only needs a
+	// column per byte that actually appears in a name. Bytes that do not appear in any
+	// name share class 0.
+	classes    [256]int32
+	classCount int
+
+	// The automaton's transitions, indexed by state*classCount + class, and the indexes of
+	// the dependencies whose names end at each state.
+	transitions []int32
+	outputs     [][]int32
+	maxLen      int
+
+	// Returns true if the reference between start and end is bounded in a way that allows
+	// it to be matched.
+	bounded func(text string, start int, end int) bool
+}
+
+// Constructs a new MultiMatcher that finds references to the given dependencies.
+func NewMultiMatcher(dependencies []*Dependency) *MultiMatcher {
+	return newMultiMatcher(dependencies, false, wordBounded)
+}
+
+// Constructs a new MultiMatcher that finds references to the given dependencies regardless
+// of the case of their ASCII letters.
+func NewCaseInsensitiveMatcher(dependencies []*Dependency) *MultiMatcher {
+	return newMultiMatcher(dependencies, true, wordBounded)
+}
+
+// Constructs a new MultiMatcher that only finds references to the given dependencies where
+// they form a whole token of a programming language, i.e. where they are not preceded or
+// followed by a letter, digit or underscore. Unlike the other matchers, references are also
+// found at the very start and end of the text.
+func NewTokenMatcher(dependencies []*Dependency) *MultiMatcher {
+	return newMultiMatcher(dependencies, false, tokenBounded)
+}
+
+func newMultiMatcher(dependencies []*Dependency, foldCase bool, bounded func(string, int, int) bool) *MultiMatcher {
+	m := &MultiMatcher{dependencies: dependencies, classCount: 1, bounded: bounded}
+	for _, dep := range dependencies {
+		for i := 0; i < len(dep.Name); i++ {
+			b := dep.Name[i]
+			if foldCase {
+				b = toLower(b)
+			}
+			if m.classes[b] == 0 {
+				m.classes[b] = int32(m.classCount)
+				m.classCount++
+			}
+		}
+		if len(dep.Name) > m.maxLen {
+			m.maxLen = len(dep.Name)
+		}
+	}
+	if foldCase {
+		// Upper case letters share the class of their lower case equivalents, so that
+		// the automaton cannot tell them apart.
+		for b := 'A'; b <= 'Z'; b++ {
+			m.classes[b] = m.classes[b+'a'-'A']
+		}
+	}
+
+	// First, build a trie of the names.
+	children := []map[int32]int32{{}}
+	outputs := [][]int32{nil}
+	for i, dep := range dependencies {
+		if dep.Name == "" {
+			continue
+		}
+		state := int32(0)
+		for j := 0; j < len(dep.Name); j++ {
+			class := m.classes[dep.Name[j]]
+			next, ok := children[state][class]
+			if !ok {
+				next = int32(len(children))
+				children = append(children, map[int32]int32{})
+				outputs = append(outputs, nil)
+				children[state][class] = next
+			}
+			state = next
+		}
+		outputs[state] = append(outputs[state], int32(i))
+	}
+
+	// Then, walk the trie breadth first, computing the failure link of each state and
+	// using it to fill in the transitions missing from the trie. This turns the trie into a
+	// deterministic automaton, so that searching never needs to follow failure links.
+	m.transitions = make([]int32, len(children)*m.classCount)
+	fail := make([]int32, len(children))
+	queue := []int32{}
+	for class, child := range children[0] {
+		m.transitions[class] = child
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for class := int32(0); class < int32(m.classCount); class++ {
+			fallback := m.transitions[int(fail[state])*m.classCount+int(class)]
+			child, ok := children[state][class]
+			if !ok {
+				m.transitions[int(state)*m.classCount+int(class)] = fallback
+				continue
+			}
+			fail[child] = fallback
+			outputs[child] = append(outputs[child], outputs[fallback]...)
+			m.transitions[int(state)*m.classCount+int(class)] = child
+			queue = append(queue, child)
+		}
+	}
+	m.outputs = outputs
+	return m
+}
+
+// Returns the length of the longest name the MultiMatcher searches for.
+func (m *MultiMatcher) MaxLen() int {
+	return m.maxLen
+}
+
+// Returns every reference to the MultiMatcher's dependencies in the given text, in the
+// order in which they end.
+func (m *MultiMatcher) FindAll(text string) []Match {
+	matches := []Match{}
+	state := int32(0)
+	for i := 0; i < len(text); i++ {
+		state = m.transitions[int(state)*m.classCount+int(m.classes[text[i]])]
+		for _, index := range m.outputs[state] {
+			dep := m.dependencies[index]
+			start := i + 1 - len(dep.Name)
+			end := i + 1
+			if !m.bounded(text, start, end) {
+				continue
+			}
+			matches = append(matches, Match{Dependency: dep, Start: start, End: end})
+		}
+	}
+	return matches
+}
+
+// Returns true if the reference between start and end is surrounded by non-letter
+// characters. As with Dependency.Matches, references at the very start or end of the
+// text are not matched.
+func wordBounded(text string, start int, end int) bool {
+	return start > 0 && !isLetter(text[start-1]) && end < len(text) && !isLetter(text[end])
+}
+
+// Returns true if the reference between start and end is not part of a longer identifier.
+func tokenBounded(text string, start int, end int) bool {
+	return (start == 0 || !isIdentifier(text[start-1])) && (end == len(text) || !isIdentifier(text[end]))
+}
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+func isIdentifier(b byte) bool {
+	return isLetter(b) || (b >= '0' && b <= '9') || b == '_'
+}
+
+func toLower(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
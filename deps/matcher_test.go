@@ -0,0 +1,153 @@
+package deps
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func names(matches []Match) []string {
+	result := []string{}
+	for _, match := range matches {
+		result = append(result, match.Dependency.Name)
+	}
+	return result
+}
+
+func TestMultiMatcherFindAll_ShouldMatchEachDependency(t *testing.T) {
+	sut := NewMultiMatcher([]*Dependency{{Name: "foo"}, {Name: "bar"}})
+
+	matches := sut.FindAll(" bar.foo(bar) ")
+
+	assert.Equal(t, []string{"bar", "foo", "bar"}, names(matches))
+	assert.Equal(t, 1, matches[0].Start)
+	assert.Equal(t, 4, matches[0].End)
+}
+
+func TestMultiMatcherFindAll_ShouldNotMatchWhenTextSurroundedByOtherChars(t *testing.T) {
+	sut := NewMultiMatcher([]*Dependency{{Name: "foo"}})
+
+	matches := sut.FindAll("spamfooeggs spamfoo fooeggs")
+
+	assert.Empty(t, matches)
+}
+
+func TestMultiMatcherFindAll_ShouldNotMatchAtEdgesOfText(t *testing.T) {
+	sut := NewMultiMatcher([]*Dependency{{Name: "foo"}})
+
+	matches := sut.FindAll("foo")
+
+	assert.Empty(t, matches)
+}
+
+func TestMultiMatcherFindAll_ShouldMatchOverlappingNames(t *testing.T) {
+	sut := NewMultiMatcher([]*Dependency{{Name: "orders"}, {Name: "orders_archive"}, {Name: "archive"}})
+
+	matches := sut.FindAll(" orders_archive ")
+
+	assert.ElementsMatch(t, []string{"orders", "orders_archive", "archive"}, names(matches))
+}
+
+func TestMultiMatcherFindAll_ShouldMatchNamesLiterally(t *testing.T) {
+	sut := NewMultiMatcher([]*Dependency{{Name: "dbo.orders"}})
+
+	matches := sut.FindAll(" dbo_orders dbo.orders ")
+
+	assert.Equal(t, 1, len(matches))
+	assert.Equal(t, 12, matches[0].Start)
+}
+
+func TestMultiMatcherFindAll_ShouldAgreeWithDependencyMatches(t *testing.T) {
+	dependencies := benchmarkDependencies(50)
+	text := benchmarkText(dependencies, 2000)
+	sut := NewMultiMatcher(dependencies)
+
+	found := map[string]bool{}
+	for _, match := range sut.FindAll(text) {
+		found[match.Dependency.Name] = true
+	}
+
+	for _, dep := range dependencies {
+		assert.Equal(t, dep.Matches(text), found[dep.Name], dep.Name)
+	}
+}
+
+// Builds n table-like dependency names.
+func benchmarkDependencies(n int) []*Dependency {
+	dependencies := []*Dependency{}
+	for i := 0; i < n; i++ {
+		dependencies = append(dependencies, &Dependency{Name: fmt.Sprintf("tbl_%s_%d", strings.Repeat("x", i%7), i)})
+	}
+	return dependencies
+}
+
+// Builds a file-like text of the given number of lines, which references a few of the
+// given dependencies amongst plenty of other identifiers.
+func benchmarkText(dependencies []*Dependency, lines int) string {
+	random := rand.New(rand.NewSource(1))
+	words := []string{"select", "from", "where", "join", "tbl_", "value", "x", "="}
+	builder := strings.Builder{}
+	for i := 0; i < lines; i++ {
+		for j := 0; j < 8; j++ {
+			builder.WriteString(words[random.Intn(len(words))])
+			builder.WriteString(" ")
+		}
+		if random.Intn(20) == 0 {
+			builder.WriteString(dependencies[random.Intn(len(dependencies))].Name)
+		}
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+func benchmarkDependencyMatches(b *testing.B, n int) {
+	dependencies := benchmarkDependencies(n)
+	text := benchmarkText(dependencies, 2000)
+	b.SetBytes(int64(len(text)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, dep := range dependencies {
+			dep.Matches(text)
+		}
+	}
+}
+
+func benchmarkMultiMatcher(b *testing.B, n int) {
+	dependencies := benchmarkDependencies(n)
+	text := benchmarkText(dependencies, 2000)
+	sut := NewMultiMatcher(dependencies)
+	b.SetBytes(int64(len(text)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sut.FindAll(text)
+	}
+}
+
+func BenchmarkDependencyMatches_10(b *testing.B)  { benchmarkDependencyMatches(b, 10) }
+func BenchmarkDependencyMatches_100(b *testing.B) { benchmarkDependencyMatches(b, 100) }
+func BenchmarkDependencyMatches_500(b *testing.B) { benchmarkDependencyMatches(b, 500) }
+func BenchmarkMultiMatcher_10(b *testing.B)       { benchmarkMultiMatcher(b, 10) }
+func BenchmarkMultiMatcher_100(b *testing.B)      { benchmarkMultiMatcher(b, 100) }
+func BenchmarkMultiMatcher_500(b *testing.B)      { benchmarkMultiMatcher(b, 500) }
+
+func TestCaseInsensitiveMatcherFindAll_ShouldMatchRegardlessOfCase(t *testing.T) {
+	sut := NewCaseInsensitiveMatcher([]*Dependency{{Name: "Orders"}})
+
+	matches := sut.FindAll(" orders ORDERS oRdErS ordersx ")
+
+	assert.Equal(t, 3, len(matches))
+	assert.Equal(t, 8, matches[1].Start)
+}
+
+func TestTokenMatcherFindAll_ShouldOnlyMatchWholeTokens(t *testing.T) {
+	sut := NewTokenMatcher([]*Dependency{{Name: "orders"}})
+
+	matches := sut.FindAll("orders orders_archive orders2 _orders (orders)")
+
+	assert.Equal(t, 2, len(matches))
+	assert.Equal(t, 0, matches[0].Start)
+	assert.Equal(t, 39, matches[1].Start)
+}
@@ -0,0 +1,56 @@
+package deps
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// The length assumed of the longest reference a RegexMatcher can find, since regular
+// expressions may match text of any length. References longer than this might be missed
+// if they span the boundary between two chunks of a very long line.
+const regexMaxLen = 1024
+
+// Finds references to dependencies whose names are interpreted as regular expressions. As
+// with MultiMatcher, a reference is only found if it is surrounded by non-letter characters.
+type RegexMatcher struct {
+	dependencies []*Dependency
+	regexps      []*regexp.Regexp
+}
+
+// Constructs a new RegexMatcher, returning an error if any of the dependencies' names is
+// not a valid regular expression.
+func NewRegexMatcher(dependencies []*Dependency) (*RegexMatcher, error) {
+	m := &RegexMatcher{dependencies: dependencies}
+	for _, dep := range dependencies {
+		r, err := regexp.Compile(fmt.Sprintf("(?:%s)", dep.Name))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s as a regular expression: %v", dep.Name, err)
+		}
+		m.regexps = append(m.regexps, r)
+	}
+	return m, nil
+}
+
+// Returns every reference to the RegexMatcher's dependencies in the given text, in the
+// order in which they end.
+func (m *RegexMatcher) FindAll(text string) []Match {
+	matches := []Match{}
+	for i, r := range m.regexps {
+		for _, location := range r.FindAllStringIndex(text, -1) {
+			if location[0] == location[1] || !wordBounded(text, location[0], location[1]) {
+				continue
+			}
+			matches = append(matches, Match{Dependency: m.dependencies[i], Start: location[0], End: location[1]})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].End < matches[j].End
+	})
+	return matches
+}
+
+// Returns the length assumed of the longest reference, regexMaxLen.
+func (m *RegexMatcher) MaxLen() int {
+	return regexMaxLen
+}
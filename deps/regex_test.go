@@ -0,0 +1,32 @@
+package deps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegexMatcherFindAll_ShouldMatchNamesAsRegularExpressions(t *testing.T) {
+	sut, err := NewRegexMatcher([]*Dependency{{Name: "orders_[0-9]+"}, {Name: "foo|bar"}})
+
+	matches := sut.FindAll(" orders_2019 bar orders_x foo ")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"orders_[0-9]+", "foo|bar", "foo|bar"}, names(matches))
+	assert.Equal(t, 1, matches[0].Start)
+	assert.Equal(t, 12, matches[0].End)
+}
+
+func TestRegexMatcherFindAll_ShouldNotMatchWhenTextSurroundedByOtherChars(t *testing.T) {
+	sut, _ := NewRegexMatcher([]*Dependency{{Name: "fo+"}})
+
+	matches := sut.FindAll("spamfooeggs spamfoo fooeggs")
+
+	assert.Empty(t, matches)
+}
+
+func TestNewRegexMatcher_ShouldReturnErrorForInvalidExpression(t *testing.T) {
+	_, err := NewRegexMatcher([]*Dependency{{Name: "orders("}})
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,144 @@
+package deps
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The name of the Matcher used for dependencies that do not name one of their own.
+const DefaultMatcher = "word"
+
+// Constructs a Matcher that finds references to the given dependencies.
+type MatcherFactory func(dependencies []*Dependency) (Matcher, error)
+
+var matcherFactories = map[string]MatcherFactory{}
+var matcherFactoriesMutex sync.Mutex
+
+func init() {
+	RegisterMatcher("word", func(dependencies []*Dependency) (Matcher, error) {
+		return NewMultiMatcher(dependencies), nil
+	})
+	RegisterMatcher("case-insensitive", func(dependencies []*Dependency) (Matcher, error) {
+		return NewCaseInsensitiveMatcher(dependencies), nil
+	})
+	RegisterMatcher("token", func(dependencies []*Dependency) (Matcher, error) {
+		return NewTokenMatcher(dependencies), nil
+	})
+	RegisterMatcher("regex", func(dependencies []*Dependency) (Matcher, error) {
+		return NewRegexMatcher(dependencies)
+	})
+	RegisterMatcher("sql", func(dependencies []*Dependency) (Matcher, error) {
+		return NewSQLMatcher(dependencies), nil
+	})
+}
+
+// Registers a Matcher under the given name, replacing any already registered under it, so
+// that it can be selected for dependencies and files by name.
+func RegisterMatcher(name string, factory MatcherFactory) {
+	matcherFactoriesMutex.Lock()
+	defer matcherFactoriesMutex.Unlock()
+	matcherFactories[name] = factory
+}
+
+// Returns true if a Matcher is registered under the given name.
+func HasMatcher(name string) bool {
+	matcherFactoriesMutex.Lock()
+	defer matcherFactoriesMutex.Unlock()
+	_, ok := matcherFactories[name]
+	return ok
+}
+
+// Returns the names of the registered Matchers, in alphabetical order.
+func MatcherNames() []string {
+	matcherFactoriesMutex.Lock()
+	defer matcherFactoriesMutex.Unlock()
+	names := []string{}
+	for name := range matcherFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Constructs the Matcher registered under the given name, for the given dependencies.
+func NewMatcher(name string, dependencies []*Dependency) (Matcher, error) {
+	matcherFactoriesMutex.Lock()
+	factory, ok := matcherFactories[name]
+	matcherFactoriesMutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no matcher is registered as %q (expected one of %s)", name, strings.Join(MatcherNames(), ", "))
+	}
+	return factory(dependencies)
+}
+
+// Constructs a Matcher that finds references to each of the given dependencies using the
+// Matcher named by the dependency, or the named fallback if the dependency does not name one.
+func BuildMatcher(dependencies []*Dependency, fallback string) (Matcher, error) {
+	names := []string{}
+	byName := map[string][]*Dependency{}
+	for _, dep := range dependencies {
+		name := dep.Matcher
+		if name == "" {
+			name = fallback
+		}
+		if _, ok := byName[name]; !ok {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], dep)
+	}
+	if len(names) == 0 {
+		return NewMatcher(fallback, nil)
+	}
+
+	combined := combinedMatcher{}
+	for _, name := range names {
+		matcher, err := NewMatcher(name, byName[name])
+		if err != nil {
+			return nil, err
+		}
+		combined = append(combined, matcher)
+	}
+	if len(combined) == 1 {
+		return combined[0], nil
+	}
+	return combined, nil
+}
+
+// Combines the references found by several Matchers.
+type combinedMatcher []Matcher
+
+// Returns every reference found by any of the Matchers, in the order in which they end.
+func (c combinedMatcher) FindAll(text string) []Match {
+	matches := []Match{}
+	for _, matcher := range c {
+		matches = append(matches, matcher.FindAll(text)...)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].End < matches[j].End
+	})
+	return matches
+}
+
+// Returns the longest MaxLen of any of the Matchers.
+func (c combinedMatcher) MaxLen() int {
+	maxLen := 0
+	for _, matcher := range c {
+		if matcher.MaxLen() > maxLen {
+			maxLen = matcher.MaxLen()
+		}
+	}
+	return maxLen
+}
+
+// Splits a dependency given as "name:matcher" into its name and the name of the Matcher
+// used to find it. If the text after the last colon is not the name of a registered
+// Matcher, the whole of the text is taken to be the dependency's name.
+func ParseDependency(text string) (name string, matcher string) {
+	i := strings.LastIndex(text, ":")
+	if i > 0 && HasMatcher(text[i+1:]) {
+		return text[:i], text[i+1:]
+	}
+	return text, ""
+}
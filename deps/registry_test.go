@@ -0,0 +1,59 @@
+package deps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatcherNames_ShouldIncludeBuiltInMatchers(t *testing.T) {
+	names := MatcherNames()
+
+	assert.Subset(t, names, []string{"case-insensitive", "regex", "sql", "token", "word"})
+}
+
+func TestNewMatcher_ShouldReturnErrorForUnknownName(t *testing.T) {
+	_, err := NewMatcher("missing", nil)
+
+	assert.NotNil(t, err)
+}
+
+func TestParseDependency_ShouldSplitRegisteredMatcher(t *testing.T) {
+	for text, expected := range map[string][2]string{
+		"orders:sql":    {"orders", "sql"},
+		"orders":        {"orders", ""},
+		"std::vector":   {"std::vector", ""},
+		"orders:tables": {"orders:tables", ""},
+		":sql":          {":sql", ""},
+	} {
+		name, matcher := ParseDependency(text)
+
+		assert.Equal(t, expected, [2]string{name, matcher}, text)
+	}
+}
+
+func TestBuildMatcher_ShouldUseEachDependencysMatcher(t *testing.T) {
+	dependencies := []*Dependency{{Name: "Orders", Matcher: "case-insensitive"}, {Name: "customers"}}
+	sut, err := BuildMatcher(dependencies, "token")
+
+	matches := sut.FindAll("customers join ORDERS on customers_id")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"customers", "Orders"}, names(matches))
+}
+
+func TestBuildMatcher_ShouldReturnErrorForUnknownMatcher(t *testing.T) {
+	_, err := BuildMatcher([]*Dependency{{Name: "orders", Matcher: "missing"}}, "word")
+
+	assert.NotNil(t, err)
+}
+
+func TestBuildDependencies_ShouldParseMatchers(t *testing.T) {
+	sut := BuildDependencies([]string{"orders:sql", "customers"})
+
+	dependencies := sut.Slice()
+
+	assert.Equal(t, "orders", dependencies[0].Name)
+	assert.Equal(t, "sql", dependencies[0].Matcher)
+	assert.Equal(t, "", dependencies[1].Matcher)
+}
@@ -0,0 +1,171 @@
+package deps
+
+import (
+	"strings"
+)
+
+// Finds references to dependencies as SQL identifiers, such as tables, views and stored
+// procedures.
+//
+// Identifiers are compared regardless of case, may be quoted with square brackets, double
+// quotes or backticks (the latter two only around letters, digits and underscores, since
+// they also quote strings), and may be qualified: a dependency named orders is found in
+// dbo.orders, [dbo].[orders] and orders.id, and one named dbo.orders is found in
+// "dbo"."orders". Unlike MultiMatcher, an identifier must not be preceded or followed by a
+// letter, digit or underscore, so orders is not found in orders_archive.
+type SQLMatcher struct {
+	// Maps the normalised name of each dependency (see normaliseSQLName) to the
+	// dependencies with that name.
+	names    map[string][]*Dependency
+	maxParts int
+	maxLen   int
+}
+
+// Constructs a new SQLMatcher that finds references to the given dependencies.
+func NewSQLMatcher(dependencies []*Dependency) *SQLMatcher {
+	m := &SQLMatcher{names: map[string][]*Dependency{}}
+	for _, dep := range dependencies {
+		name := normaliseSQLName(dep.Name)
+		if name == "" {
+			continue
+		}
+		m.names[name] = append(m.names[name], dep)
+		parts := strings.Count(name, ".") + 1
+		if parts > m.maxParts {
+			m.maxParts = parts
+		}
+		// Each part of the name might be quoted when it is referenced.
+		if length := len(name) + 2*parts; length > m.maxLen {
+			m.maxLen = length
+		}
+	}
+	return m
+}
+
+// Returns the length of the longest reference the SQLMatcher can find, allowing for each
+// part of the name being quoted.
+func (m *SQLMatcher) MaxLen() int {
+	return m.maxLen
+}
+
+// Represents one part of a possibly qualified SQL identifier found in some text.
+type sqlIdentifier struct {
+	Name  string
+	Start int
+	End   int
+}
+
+// Returns every reference to the SQLMatcher's dependencies in the given text, in the order
+// in which they end.
+func (m *SQLMatcher) FindAll(text string) []Match {
+	matches := []Match{}
+	if len(m.names) == 0 {
+		return matches
+	}
+	i := 0
+	for i < len(text) {
+		identifier, ok := readSQLIdentifier(text, i)
+		if !ok {
+			i++
+			continue
+		}
+
+		// Read the rest of the qualified identifier, e.g. the orders and id of dbo.orders.id.
+		chain := []sqlIdentifier{identifier}
+		i = identifier.End
+		for i < len(text) && text[i] == '.' {
+			next, ok := readSQLIdentifier(text, i+1)
+			if !ok {
+				break
+			}
+			chain = append(chain, next)
+			i = next.End
+		}
+		matches = append(matches, m.matchChain(chain)...)
+	}
+	return matches
+}
+
+// Returns the references to the SQLMatcher's dependencies made by any run of consecutive
+// parts of the given qualified identifier, in the order in which they end.
+func (m *SQLMatcher) matchChain(chain []sqlIdentifier) []Match {
+	matches := []Match{}
+	for last := range chain {
+		for first := last; first >= 0 && last-first < m.maxParts; first-- {
+			names := []string{}
+			for _, identifier := range chain[first : last+1] {
+				names = append(names, identifier.Name)
+			}
+			for _, dep := range m.names[strings.Join(names, ".")] {
+				matches = append(matches, Match{Dependency: dep, Start: chain[first].Start, End: chain[last].End})
+			}
+		}
+	}
+	return matches
+}
+
+// Reads the SQL identifier starting at the given offset of the text, returning false if
+// there is not one there. The identifier's name is returned unquoted and in lower case.
+func readSQLIdentifier(text string, start int) (sqlIdentifier, bool) {
+	if start >= len(text) {
+		return sqlIdentifier{}, false
+	}
+	if closing := sqlClosingQuote(text[start]); closing != 0 {
+		end := strings.IndexByte(text[start+1:], closing)
+		if end <= 0 {
+			return sqlIdentifier{}, false
+		}
+		end += start + 1
+		// Double quotes and backticks also delimit strings in the code that SQL is often
+		// embedded in, e.g. db.Query("select * from orders"), so they are only taken to
+		// quote an identifier if what they hold looks like one. Otherwise, the quote is
+		// skipped, and the text within it is read as usual.
+		if closing != ']' && !isSQLIdentifier(text[start+1:end]) {
+			return sqlIdentifier{}, false
+		}
+		return sqlIdentifier{Name: strings.ToLower(text[start+1 : end]), Start: start, End: end + 1}, true
+	}
+	if !isIdentifier(text[start]) || (start > 0 && isIdentifier(text[start-1])) {
+		return sqlIdentifier{}, false
+	}
+	end := start
+	for end < len(text) && isIdentifier(text[end]) {
+		end++
+	}
+	return sqlIdentifier{Name: strings.ToLower(text[start:end]), Start: start, End: end}, true
+}
+
+// Returns true if the text is made up of letters, digits and underscores alone.
+func isSQLIdentifier(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if !isIdentifier(text[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the character that closes a quoted identifier opened with the given character,
+// or 0 if it does not open one.
+func sqlClosingQuote(b byte) byte {
+	switch b {
+	case '[':
+		return ']'
+	case '"', '`':
+		return b
+	}
+	return 0
+}
+
+// Returns a dependency's name in the form in which the SQLMatcher compares identifiers:
+// in lower case, without quotes around any of its parts.
+func normaliseSQLName(name string) string {
+	parts := []string{}
+	for _, part := range strings.Split(name, ".") {
+		if len(part) >= 2 && sqlClosingQuote(part[0]) == part[len(part)-1] {
+			part = part[1 : len(part)-1]
+		}
+		parts = append(parts, strings.ToLower(part))
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,58 @@
+package deps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLMatcherFindAll_ShouldMatchQuotedAndQualifiedIdentifiers(t *testing.T) {
+	sut := NewSQLMatcher([]*Dependency{{Name: "orders"}})
+
+	matches := sut.FindAll(`select * from dbo.orders join [dbo].[Orders] on "ORDERS".id = orders.id`)
+
+	assert.Equal(t, 4, len(matches))
+	assert.Equal(t, 18, matches[0].Start)
+	assert.Equal(t, 24, matches[0].End)
+	assert.Equal(t, 36, matches[1].Start)
+	assert.Equal(t, 44, matches[1].End)
+}
+
+func TestSQLMatcherFindAll_ShouldNotMatchPartsOfIdentifiers(t *testing.T) {
+	sut := NewSQLMatcher([]*Dependency{{Name: "orders"}})
+
+	matches := sut.FindAll("select * from orders_archive join orders2 on x.xorders = 1")
+
+	assert.Empty(t, matches)
+}
+
+func TestSQLMatcherFindAll_ShouldMatchQualifiedNames(t *testing.T) {
+	sut := NewSQLMatcher([]*Dependency{{Name: "[dbo].[orders]"}})
+
+	matches := sut.FindAll("exec sales.orders; select * from DBO.orders; select * from server.dbo.orders.id")
+
+	assert.Equal(t, 2, len(matches))
+	assert.Equal(t, 33, matches[0].Start)
+	assert.Equal(t, 43, matches[0].End)
+	assert.Equal(t, 66, matches[1].Start)
+}
+
+func TestSQLMatcherFindAll_ShouldMatchAtEdgesOfText(t *testing.T) {
+	sut := NewSQLMatcher([]*Dependency{{Name: "orders"}})
+
+	matches := sut.FindAll("orders")
+
+	assert.Equal(t, 1, len(matches))
+}
+
+func TestSQLMatcherFindAll_ShouldMatchIdentifiersWithinStrings(t *testing.T) {
+	sut := NewSQLMatcher([]*Dependency{{Name: "orders"}})
+
+	matches := sut.FindAll(`db.Query("select * from orders"); db.Execute("orders");`)
+
+	assert.Equal(t, 2, len(matches))
+	assert.Equal(t, 24, matches[0].Start)
+	assert.Equal(t, 30, matches[0].End)
+	assert.Equal(t, 45, matches[1].Start)
+	assert.Equal(t, 53, matches[1].End)
+}
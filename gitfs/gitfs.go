@@ -0,0 +1,307 @@
+// Package gitfs reads the tree of a commit in a git repository as an io/fs file system,
+// without checking it out, by reading objects from the repository's object database using
+// the git command line.
+package gitfs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Represents the tree of a commit in a git repository as a read-only file system. Files
+// are read from the repository's object database when they are opened, so the working
+// tree is neither read nor changed.
+//
+// Only regular files are included; symbolic links and submodules are left out.
+type FS struct {
+	dir     string
+	entries map[string]*entry
+
+	// A long running `git cat-file --batch` process, from which the contents of files are
+	// read one at a time.
+	catFile *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  *bufio.Reader
+	mutex   sync.Mutex
+}
+
+// Represents a file or directory within the tree.
+type entry struct {
+	name     string
+	hash     string
+	size     int64
+	mode     fs.FileMode
+	children []string
+}
+
+// Opens the tree of the commit that ref (a branch, tag or commit hash) refers to in the
+// git repository at dir, which may be a directory within the repository, in which case
+// only the files within that directory are included. If ref cannot be found, but a remote
+// tracking branch of the same name exists for origin (as is typical of a shallow clone),
+// the remote tracking branch is used instead. The file system must be closed once it is finished with.
+func Open(dir string, ref string) (*FS, error) {
+	tree, err := resolveTree(dir, ref)
+	if err != nil {
+		return nil, err
+	}
+	listing, err := git(dir, "ls-tree", "--full-tree", "-r", "-l", "-z", tree)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FS{dir: dir, entries: map[string]*entry{".": {name: ".", mode: fs.ModeDir | 0555}}}
+	for _, line := range bytes.Split(listing, []byte{0}) {
+		// Each line is formatted as "<mode> <type> <hash> <size>\t<path>".
+		fields := strings.SplitN(string(line), "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		info := strings.Fields(fields[0])
+		if len(info) != 4 || info[1] != "blob" || !strings.HasPrefix(info[0], "100") {
+			continue
+		}
+		size, err := strconv.ParseInt(info[3], 10, 64)
+		if err != nil || !fs.ValidPath(fields[1]) {
+			continue
+		}
+		mode := fs.FileMode(0444)
+		if info[0] == "100755" {
+			mode = 0555
+		}
+		f.add(&entry{name: fields[1], hash: info[2], size: size, mode: mode})
+	}
+	for _, e := range f.entries {
+		sort.Strings(e.children)
+	}
+	return f, nil
+}
+
+// Returns the hash of the tree of the commit that ref refers to, or of the subtree holding
+// dir, if it is not the root of the repository.
+func resolveTree(dir string, ref string) (string, error) {
+	prefix, err := git(dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", fmt.Errorf("%s is not a git repository", dir)
+	}
+	for _, candidate := range []string{ref, "origin/" + ref} {
+		output, err := git(dir, "rev-parse", "--verify", "--quiet", candidate+":"+strings.TrimSuffix(strings.TrimSpace(string(prefix)), "/"))
+		if err == nil {
+			return strings.TrimSpace(string(output)), nil
+		}
+	}
+	return "", fmt.Errorf("%s could not be found in %s", ref, dir)
+}
+
+// Adds a file to the tree, along with any of its parent directories that are missing.
+func (f *FS) add(e *entry) {
+	f.entries[e.name] = e
+	child := e.name
+	for child != "." {
+		parent := path.Dir(child)
+		p, ok := f.entries[parent]
+		if !ok {
+			p = &entry{name: parent, mode: fs.ModeDir | 0555}
+			f.entries[parent] = p
+		}
+		p.children = append(p.children, path.Base(child))
+		if ok {
+			return
+		}
+		child = parent
+	}
+}
+
+// Stops the process used to read files from the repository.
+func (f *FS) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.catFile == nil {
+		return nil
+	}
+	f.stdin.Close()
+	err := f.catFile.Wait()
+	f.catFile = nil
+	return err
+}
+
+// Opens the named file or directory.
+func (f *FS) Open(name string) (fs.File, error) {
+	e, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.mode.IsDir() {
+		return &dir{entry: e, fsys: f}, nil
+	}
+	contents, err := f.read(e.hash)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{entry: e, Reader: bytes.NewReader(contents)}, nil
+}
+
+// Returns information about the named file or directory.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	e, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Returns the entries of the named directory, sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return f.children(e), nil
+}
+
+func (f *FS) lookup(op string, name string) (*entry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := f.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+func (f *FS) children(e *entry) []fs.DirEntry {
+	children := []fs.DirEntry{}
+	for _, child := range e.children {
+		children = append(children, f.entries[path.Join(e.name, child)])
+	}
+	return children
+}
+
+// Reads the contents of the blob with the given hash, starting the `git cat-file --batch`
+// process if it is not already running.
+func (f *FS) read(hash string) ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.catFile == nil {
+		catFile := exec.Command("git", "cat-file", "--batch")
+		catFile.Dir = f.dir
+		stdin, err := catFile.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := catFile.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := catFile.Start(); err != nil {
+			return nil, err
+		}
+		f.catFile, f.stdin, f.stdout = catFile, stdin, bufio.NewReader(stdout)
+	}
+
+	if _, err := fmt.Fprintln(f.stdin, hash); err != nil {
+		return nil, err
+	}
+	// The contents are preceded by a header of "<hash> <type> <size>\n", and followed by
+	// a new line.
+	header, err := f.stdout.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected response from git cat-file: %s", strings.TrimSpace(header))
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	contents := make([]byte, size+1)
+	if _, err := io.ReadFull(f.stdout, contents); err != nil {
+		return nil, err
+	}
+	return contents[:size], nil
+}
+
+// Runs git with the given arguments in dir, returning its output.
+func git(dir string, args ...string) ([]byte, error) {
+	command := exec.Command("git", args...)
+	command.Dir = dir
+	return command.Output()
+}
+
+// Provides the fs.FileInfo implementation for entries.
+func (e *entry) Name() string       { return path.Base(e.name) }
+func (e *entry) Size() int64        { return e.size }
+func (e *entry) Mode() fs.FileMode  { return e.mode }
+func (e *entry) ModTime() time.Time { return time.Time{} }
+func (e *entry) IsDir() bool        { return e.mode.IsDir() }
+func (e *entry) Sys() interface{}   { return nil }
+
+// Provides the rest of the fs.DirEntry implementation for entries.
+func (e *entry) Type() fs.FileMode          { return e.mode.Type() }
+func (e *entry) Info() (fs.FileInfo, error) { return e, nil }
+
+// Represents a file within the tree that has been opened for reading.
+type file struct {
+	*bytes.Reader
+	entry *entry
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.entry, nil
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+// Represents a directory within the tree that has been opened for reading.
+type dir struct {
+	entry  *entry
+	fsys   *FS
+	offset int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.entry, nil
+}
+
+func (d *dir) Read(b []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+// Returns the next n entries of the directory, or all of the remaining entries if n <= 0.
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	children := d.fsys.children(d.entry)[d.offset:]
+	if n <= 0 {
+		d.offset += len(children)
+		return children, nil
+	}
+	if len(children) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(children) {
+		n = len(children)
+	}
+	d.offset += n
+	return children[:n], nil
+}
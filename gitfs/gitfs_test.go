@@ -0,0 +1,123 @@
+package gitfs
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Runs git with the given arguments in dir, failing the test if it returns an error.
+func run(t *testing.T, dir string, args ...string) {
+	args = append([]string{"-c", "user.name=depgrok", "-c", "user.email=depgrok@example.com"}, args...)
+	git := exec.Command("git", args...)
+	git.Dir = dir
+	if output, err := git.CombinedOutput(); err != nil {
+		t.Fatalf("Error running git %v: %v\n%s", args, err, output)
+	}
+}
+
+// Writes the given files to dir and commits them.
+func commit(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run(t, dir, "add", ".")
+	run(t, dir, "commit", "-q", "-m", "commit")
+}
+
+// Creates a git repo with a main branch and a release branch that differ.
+func gitRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	run(t, dir, "init", "-q")
+	run(t, dir, "checkout", "-q", "-b", "main")
+	commit(t, dir, map[string]string{"db/orders.sql": "create table orders\n", "README.md": "orders\n"})
+	run(t, dir, "checkout", "-q", "-b", "release")
+	commit(t, dir, map[string]string{"db/customers.sql": "create table customers\n"})
+	run(t, dir, "checkout", "-q", "main")
+	commit(t, dir, map[string]string{"db/orders.sql": "create table orders_v2\n"})
+	return dir
+}
+
+func TestOpen_ShouldReadTreeOfRef(t *testing.T) {
+	dir := gitRepo(t)
+
+	fsys, err := Open(dir, "release")
+
+	if err != nil {
+		t.Fatalf("Unexpected error opening release: %v", err)
+	}
+	defer fsys.Close()
+	if err := fstest.TestFS(fsys, "db/orders.sql", "db/customers.sql", "README.md"); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := fs.ReadFile(fsys, "db/orders.sql")
+	assert.Nil(t, err)
+	assert.Equal(t, "create table orders\n", string(contents))
+}
+
+func TestOpen_ShouldNotReadWorkingTree(t *testing.T) {
+	dir := gitRepo(t)
+	ioutil.WriteFile(filepath.Join(dir, "db", "orders.sql"), []byte("uncommitted\n"), 0644)
+
+	fsys, err := Open(dir, "main")
+
+	if err != nil {
+		t.Fatalf("Unexpected error opening main: %v", err)
+	}
+	defer fsys.Close()
+	contents, err := fs.ReadFile(fsys, "db/orders.sql")
+	assert.Nil(t, err)
+	assert.Equal(t, "create table orders_v2\n", string(contents))
+	_, err = fs.Stat(fsys, "db/customers.sql")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOpen_ShouldFallBackToRemoteTrackingBranch(t *testing.T) {
+	origin := gitRepo(t)
+	dir := filepath.Join(t.TempDir(), "clone")
+	run(t, filepath.Dir(dir), "clone", "-q", "--no-single-branch", "--branch", "main", origin, dir)
+
+	fsys, err := Open(dir, "release")
+
+	if err != nil {
+		t.Fatalf("Unexpected error opening release: %v", err)
+	}
+	defer fsys.Close()
+	_, err = fs.Stat(fsys, "db/customers.sql")
+	assert.Nil(t, err)
+}
+
+func TestOpen_ShouldReturnErrorForMissingRef(t *testing.T) {
+	dir := gitRepo(t)
+
+	_, err := Open(dir, "missing")
+
+	assert.NotNil(t, err)
+}
+
+func TestOpen_ShouldReadSubtreeOfDirectory(t *testing.T) {
+	dir := gitRepo(t)
+
+	fsys, err := Open(filepath.Join(dir, "db"), "release")
+
+	if err != nil {
+		t.Fatalf("Unexpected error opening release: %v", err)
+	}
+	defer fsys.Close()
+	if err := fstest.TestFS(fsys, "orders.sql", "customers.sql"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,8 @@
+module github.com/andykuszyk/depgrok
+
+go 1.16
+
+require (
+	github.com/stretchr/testify v1.7.0
+	github.com/urfave/cli v1.22.5
+)
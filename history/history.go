@@ -0,0 +1,228 @@
+// Package history uses the history of git repositories to find when references to
+// dependencies were introduced to, or removed from, the files of a repo.
+package history
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/andykuszyk/depgrok/deps"
+)
+
+// Represents a commit in the history of a repo.
+type Commit struct {
+	Hash   string
+	Author string
+	Email  string
+	Date   time.Time
+}
+
+// Returns a short description of the commit, e.g. "1a2b3c4 by Jane Doe <jane@example.com>
+// on 2019-04-01".
+func (c Commit) String() string {
+	hash := c.Hash
+	if len(hash) > 7 {
+		hash = hash[:7]
+	}
+	return fmt.Sprintf("%s by %s <%s> on %s", hash, c.Author, c.Email, c.Date.Format("2006-01-02"))
+}
+
+// Represents a file, by its slash-separated path relative to the repo, that references a
+// dependency.
+type Reference struct {
+	Path       string
+	Dependency *deps.Dependency
+}
+
+// Represents a file that referenced a dependency until the given commit.
+type Removal struct {
+	Reference
+	Commit Commit
+}
+
+// The format given to git log for each commit, which is parsed by parseLog. Each field
+// begins with a NUL character, so that the commits can be told apart from any file names
+// that follow them.
+const logFormat = "--format=%x00%H%x00%an%x00%ae%x00%aI"
+
+// Returns true if the repo at dir is a shallow clone, in which case its history is
+// incomplete, and references will appear to have been introduced by its oldest commit.
+func IsShallow(dir string) bool {
+	output, err := git(dir, "rev-parse", "--is-shallow-repository")
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// Returns the commit that last introduced a reference to dep into the file at path
+// (relative to the repo at dir), as found by the matcher, following the file across
+// renames. Each commit changing the number of times dep appears in the file is checked,
+// newest first, and the first in which the matcher finds no reference in the file before
+// the commit, but does after it, is returned, so that a reference that was removed and
+// later added back is attributed to the commit that added it back. Nil is returned if
+// there is no such commit, e.g. because the file has not been committed.
+func Introduced(dir string, path string, dep *deps.Dependency, matcher deps.Matcher) (*Commit, error) {
+	args := append([]string{"-c", "core.quotePath=false", "log", "--follow"}, pickaxe(dep, matcher)...)
+	output, err := git(dir, append(args, logFormat, "--name-only", "--relative", "--", path)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range parseLog(output) {
+		// The file is listed by the name it had after the commit, which differs from path
+		// for commits made before it was renamed.
+		name := path
+		if len(entry.Paths) > 0 {
+			name = entry.Paths[0]
+		}
+		before, _ := git(dir, "show", entry.Commit.Hash+"^:./"+name)
+		after, _ := git(dir, "show", entry.Commit.Hash+":./"+name)
+		if !referenced(matcher, before) && referenced(matcher, after) {
+			return &entry.Commit, nil
+		}
+	}
+	return nil, nil
+}
+
+// Returns the arguments given to git log to limit it to the commits that might have added
+// or removed references to dep: those changing the number of times the last identifier of
+// its name appears, regardless of case, or those changing lines that match it, if it is
+// found by a regular expression. Whether they actually did is left to the matcher to decide.
+func pickaxe(dep *deps.Dependency, matcher deps.Matcher) []string {
+	if isRegex(dep, matcher) {
+		return []string{"-G" + dep.Name}
+	}
+	return []string{"-i", "-S" + lastIdentifier(dep.Name)}
+}
+
+// Returns true if dep is found by a regular expression, rather than by its name.
+func isRegex(dep *deps.Dependency, matcher deps.Matcher) bool {
+	_, ok := matcher.(*deps.RegexMatcher)
+	return ok || dep.Matcher == "regex"
+}
+
+// Returns the last identifier of a name, which appears in every reference to it, however
+// it is qualified or quoted, e.g. orders for dbo.orders, which the sql matcher finds in
+// [dbo].[orders].
+func lastIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	return strings.Trim(parts[len(parts)-1], "[]\"`")
+}
+
+// Returns the files of the repo at dir (which may be a directory within a git repo, such as
+// a project within a monorepo) that referenced any of the dependencies, but no longer do,
+// along with the commit that removed each reference (whether by changing the file or
+// deleting it). References are found using the Matcher returned by matcherFor for the path
+// of each file and each dependency, and references that still exist, as given by current,
+// are not considered.
+//
+// The history is read with a single git log, limited to the commits changing lines that
+// contain the last identifier of any of the dependencies' names (or that match them, for
+// those found by a regular expression, which are judged by the Matcher for a file matching
+// no particular glob).
+func Removed(dir string, dependencies []*deps.Dependency, matcherFor func(path string, dep *deps.Dependency) (deps.Matcher, error), current map[Reference]bool) ([]Removal, error) {
+	if len(dependencies) == 0 {
+		return nil, nil
+	}
+	patterns := []string{}
+	for _, dep := range dependencies {
+		matcher, err := matcherFor("", dep)
+		if err != nil {
+			return nil, err
+		}
+		if isRegex(dep, matcher) {
+			patterns = append(patterns, dep.Name)
+		} else {
+			patterns = append(patterns, regexp.QuoteMeta(lastIdentifier(dep.Name)))
+		}
+	}
+	output, err := git(dir, "-c", "core.quotePath=false", "log", "-i", "-G("+strings.Join(patterns, "|")+")", logFormat, "--name-only", "--relative")
+	if err != nil {
+		return nil, err
+	}
+	removals := []Removal{}
+	decided := map[Reference]bool{}
+	// The log is ordered newest first, so the first commit found to change whether a file
+	// references a dependency is the last to do so. If it removed the reference, the
+	// removal is reported; if it added it, the reference was since removed in a way the log
+	// does not show, e.g. by renaming the file, and nothing is reported.
+	for _, entry := range parseLog(output) {
+		for _, path := range entry.Paths {
+			var before, after []byte
+			read := false
+			for _, dep := range dependencies {
+				reference := Reference{Path: path, Dependency: dep}
+				if decided[reference] || current[reference] {
+					continue
+				}
+				if !read {
+					before, _ = git(dir, "show", entry.Commit.Hash+"^:./"+path)
+					after, _ = git(dir, "show", entry.Commit.Hash+":./"+path)
+					read = true
+				}
+				matcher, err := matcherFor(path, dep)
+				if err != nil {
+					return nil, err
+				}
+				referencedBefore, referencedAfter := referenced(matcher, before), referenced(matcher, after)
+				if referencedBefore == referencedAfter {
+					continue
+				}
+				decided[reference] = true
+				if referencedBefore {
+					removals = append(removals, Removal{Reference: reference, Commit: entry.Commit})
+				}
+			}
+		}
+	}
+	return removals, nil
+}
+
+// Returns true if the matcher finds any references in the given contents.
+func referenced(matcher deps.Matcher, contents []byte) bool {
+	// Contents are searched as they would be by the search command, which passes the new
+	// line preceding each line (or nothing, for the first line) along with it.
+	for i, line := range strings.SplitAfter(string(contents), "\n") {
+		if i > 0 {
+			line = "\n" + line
+		}
+		if len(matcher.FindAll(line)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Represents a commit found in the output of git log, along with the paths of any files
+// it lists.
+type logEntry struct {
+	Commit Commit
+	Paths  []string
+}
+
+// Parses the output of git log, run with logFormat.
+func parseLog(output []byte) []logEntry {
+	entries := []logEntry{}
+	// Each commit is split into four fields by the NUL characters of logFormat, the last of
+	// which holds the date followed by the paths of any files listed.
+	fields := strings.Split(string(output), "\x00")
+	for i := 1; i+3 < len(fields); i += 4 {
+		lines := strings.Split(strings.TrimSpace(fields[i+3]), "\n")
+		date, _ := time.Parse(time.RFC3339, lines[0])
+		entry := logEntry{Commit: Commit{Hash: fields[i], Author: fields[i+1], Email: fields[i+2], Date: date}}
+		for _, path := range lines[1:] {
+			if path != "" {
+				entry.Paths = append(entry.Paths, path)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Runs git with the given arguments in dir, returning its output.
+func git(dir string, args ...string) ([]byte, error) {
+	command := exec.Command("git", args...)
+	command.Dir = dir
+	return command.Output()
+}
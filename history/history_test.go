@@ -0,0 +1,189 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/andykuszyk/depgrok/deps"
+	"github.com/stretchr/testify/assert"
+)
+
+// Commits the given changes to the repo at dir as the given author, where an empty file
+// is deleted.
+func commit(t *testing.T, dir string, author string, date string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if contents == "" {
+			os.Remove(path)
+		} else if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"add", "-A"},
+		{"-c", "user.name=" + author, "-c", "user.email=" + author + "@example.com", "commit", "-q", "-m", "change"},
+	} {
+		git := exec.Command("git", args...)
+		git.Dir = dir
+		git.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+		if output, err := git.CombinedOutput(); err != nil {
+			t.Fatalf("Error running git %v: %v\n%s", args, err, output)
+		}
+	}
+}
+
+// Creates a git repo in which references to orders are added and removed by several authors.
+func gitRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := exec.Command("git", "init", "-q")
+	git.Dir = dir
+	if output, err := git.CombinedOutput(); err != nil {
+		t.Fatalf("Error running git init: %v\n%s", err, output)
+	}
+	commit(t, dir, "alice", "2019-01-01T12:00:00Z", map[string]string{"a.sql": "select * from orders\n", "c.sql": "select 1\n"})
+	commit(t, dir, "bob", "2019-02-01T12:00:00Z", map[string]string{"c.sql": "select 1\nselect * from orders\n"})
+	commit(t, dir, "carol", "2019-03-01T12:00:00Z", map[string]string{"a.sql": "select * from customers\n"})
+	commit(t, dir, "dave", "2019-04-01T12:00:00Z", map[string]string{"d.sql": "select * from ordersarchive\n", "e.sql": "exec orders\n"})
+	commit(t, dir, "erin", "2019-05-01T12:00:00Z", map[string]string{"e.sql": ""})
+	return dir
+}
+
+// Returns the dependency named orders, along with a SQLMatcher that finds it.
+func orders() (*deps.Dependency, deps.Matcher) {
+	dep := &deps.Dependency{Name: "orders"}
+	return dep, deps.NewSQLMatcher([]*deps.Dependency{dep})
+}
+
+func TestIntroduced_ShouldReturnCommitToAddReference(t *testing.T) {
+	dir := gitRepo(t)
+	dep, matcher := orders()
+
+	commit, err := Introduced(dir, "c.sql", dep, matcher)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", commit.Author)
+	assert.Equal(t, "bob@example.com", commit.Email)
+	assert.Equal(t, "2019-02-01", commit.Date.Format("2006-01-02"))
+	assert.Regexp(t, "^[0-9a-f]{7} by bob <bob@example.com> on 2019-02-01$", commit.String())
+}
+
+func TestIntroduced_ShouldReturnNilForUncommittedFile(t *testing.T) {
+	dir := gitRepo(t)
+	ioutil.WriteFile(filepath.Join(dir, "new.sql"), []byte("select * from orders\n"), 0644)
+
+	dep, matcher := orders()
+
+	commit, err := Introduced(dir, "new.sql", dep, matcher)
+
+	assert.Nil(t, err)
+	assert.Nil(t, commit)
+}
+
+func TestIntroduced_ShouldReturnCommitToAddReferenceBackInAnotherCase(t *testing.T) {
+	dir := gitRepo(t)
+	commit(t, dir, "heidi", "2019-06-01T12:00:00Z", map[string]string{"a.sql": "select * from ORDERS\n"})
+	dep, matcher := orders()
+
+	introduced, err := Introduced(dir, "a.sql", dep, matcher)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "heidi", introduced.Author)
+}
+
+func TestIntroduced_ShouldIgnoreCommitsThatDoNotAddAReference(t *testing.T) {
+	dir := gitRepo(t)
+	commit(t, dir, "heidi", "2019-06-01T12:00:00Z", map[string]string{"c.sql": "select 1\nselect * from orders\n-- ordersarchive\n"})
+	dep, matcher := orders()
+
+	introduced, err := Introduced(dir, "c.sql", dep, matcher)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", introduced.Author)
+}
+
+// Returns a SQLMatcher for the dependency, whatever the path.
+func sqlMatcherFor(path string, dep *deps.Dependency) (deps.Matcher, error) {
+	return deps.NewSQLMatcher([]*deps.Dependency{dep}), nil
+}
+
+// Returns the authors of the commits that removed each reference, keyed by the file and
+// the name of the dependency, e.g. a.sql orders.
+func removedBy(removals []Removal) map[string]string {
+	authors := map[string]string{}
+	for _, removal := range removals {
+		authors[removal.Path+" "+removal.Dependency.Name] = removal.Commit.Author
+	}
+	return authors
+}
+
+func TestRemoved_ShouldReturnFilesNoLongerReferencingDependency(t *testing.T) {
+	dir := gitRepo(t)
+	dep := &deps.Dependency{Name: "orders"}
+
+	removals, err := Removed(dir, []*deps.Dependency{dep}, sqlMatcherFor, map[Reference]bool{{Path: "c.sql", Dependency: dep}: true})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a.sql orders": "carol", "e.sql orders": "erin"}, removedBy(removals))
+}
+
+func TestRemoved_ShouldReturnRemovalsOfEachDependency(t *testing.T) {
+	dir := gitRepo(t)
+	// Swapping one reference for another leaves the number of references unchanged.
+	commit(t, dir, "heidi", "2019-06-01T12:00:00Z", map[string]string{"a.sql": "select * from orders\n"})
+	orders := &deps.Dependency{Name: "orders"}
+	customers := &deps.Dependency{Name: "customers"}
+	current := map[Reference]bool{{Path: "a.sql", Dependency: orders}: true, {Path: "c.sql", Dependency: orders}: true}
+
+	removals, err := Removed(dir, []*deps.Dependency{orders, customers}, sqlMatcherFor, current)
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a.sql customers": "heidi", "e.sql orders": "erin"}, removedBy(removals))
+}
+
+func TestRemoved_ShouldFindQualifiedNamesHoweverTheyAreQuoted(t *testing.T) {
+	dir := gitRepo(t)
+	commit(t, dir, "heidi", "2019-06-01T12:00:00Z", map[string]string{"v.sql": "select * from [dbo].[Orders]\n"})
+	commit(t, dir, "ivan", "2019-07-01T12:00:00Z", map[string]string{"v.sql": "select 2\n"})
+	dep := &deps.Dependency{Name: "dbo.orders"}
+
+	removals, err := Removed(dir, []*deps.Dependency{dep}, sqlMatcherFor, map[Reference]bool{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"v.sql dbo.orders": "ivan"}, removedBy(removals))
+	introduced, err := Introduced(dir, "v.sql", dep, deps.NewSQLMatcher([]*deps.Dependency{dep}))
+	assert.Nil(t, err)
+	assert.Equal(t, "heidi", introduced.Author)
+}
+
+func TestIsShallow_ShouldDetectShallowClones(t *testing.T) {
+	dir := gitRepo(t)
+	clone := filepath.Join(t.TempDir(), "clone")
+	git := exec.Command("git", "clone", "-q", "--depth", "1", "file://"+dir, clone)
+	if output, err := git.CombinedOutput(); err != nil {
+		t.Fatalf("Error cloning: %v\n%s", err, output)
+	}
+
+	assert.False(t, IsShallow(dir))
+	assert.True(t, IsShallow(clone))
+}
+
+func TestRemoved_ShouldOnlyConsiderFilesWithinDirectory(t *testing.T) {
+	dir := gitRepo(t)
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	commit(t, dir, "frank", "2019-06-01T12:00:00Z", map[string]string{"sub/f.sql": "select * from orders\n"})
+	commit(t, dir, "grace", "2019-07-01T12:00:00Z", map[string]string{"sub/f.sql": "select 2\n"})
+	dep := &deps.Dependency{Name: "orders"}
+
+	removals, err := Removed(filepath.Join(dir, "sub"), []*deps.Dependency{dep}, sqlMatcherFor, map[Reference]bool{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(removals))
+	assert.Equal(t, "f.sql", removals[0].Path)
+	assert.Equal(t, "grace", removals[0].Commit.Author)
+}
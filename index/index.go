@@ -0,0 +1,653 @@
+// Package index provides a persistent inverted index of the tokens found in a tree of
+// files, so that references to dependencies can be looked up without searching the
+// files themselves.
+//
+// The index is stored in a single file, which is laid out as follows:
+//
+//	header        the magic number, followed by the number of files, the offset of the
+//	              file table, the number of tokens and the offset of the token table
+//	files         an entry (repo, path, path within the repo, modification time, size,
+//	              git blob hash and the names of the entities it defines) for each file
+//	              indexed
+//	postings      the file and line of each occurrence of each token, and the position
+//	              of the identifier it was found in within the line
+//	tokens        an entry for each token, in sorted order, holding the offset and
+//	              length of its postings
+//	file table    the offset of each file entry, plus the offset of the end of the entries
+//	token table   the offset of each token entry, plus the offset of the end of the entries
+//
+// The tables allow individual entries to be read directly from disk, so that looking up a
+// token only requires a binary search of the token table, rather than loading the whole
+// index into memory.
+//
+// An index can be updated incrementally, by carrying over the postings of files that
+// have not changed from the previous version of the index, so that only new or changed
+// files need to be tokenised again.
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+var magic = []byte("DEPGROK\x05")
+
+const headerLen = 8 + 4*8
+
+// Represents a file that has been indexed, by its repo, its path on disk and its
+// slash-separated path within the repo. The modification time (in nanoseconds since the
+// Unix epoch), size and git blob hash (if the file is tracked by git) are used to tell
+// whether the file has changed since it was last indexed. Definitions holds the names of
+// the entities the file defines (e.g. the procedures created by a SQL script), if any were
+// extracted from it when it was indexed.
+type File struct {
+	Repo        string
+	Path        string
+	InRepo      string
+	ModTime     int64
+	Size        int64
+	Hash        string
+	Definitions []string
+}
+
+// Returns true if the file appears to be unchanged since it was indexed as previous. Git
+// blob hashes are compared where both are known, since they are unaffected by checkouts
+// and pulls touching files without changing them; otherwise the modification times are.
+func (f File) Unchanged(previous File) bool {
+	if f.Repo != previous.Repo || f.Path != previous.Path || f.Size != previous.Size {
+		return false
+	}
+	if f.Hash != "" && previous.Hash != "" {
+		return f.Hash == previous.Hash
+	}
+	return f.ModTime == previous.ModTime
+}
+
+// Represents the location of a reference to a dependency found in the index, along with
+// the names of the entities defined by the file it was found in.
+type Location struct {
+	Repo        string
+	Path        string
+	InRepo      string
+	Line        int
+	Definitions []string
+}
+
+type posting struct {
+	File     int
+	Line     int
+	Position int
+}
+
+// Collects the tokens found in a set of files, so that they can be written to disk as an
+// index.
+type Builder struct {
+	files    []File
+	postings map[string][]posting
+
+	// The index being updated, if any, and a map of the ids of the files carried over
+	// from it to their ids in the new index.
+	previous *Index
+	carried  map[int]int
+}
+
+// Constructs a new, empty Builder.
+func NewBuilder() *Builder {
+	return &Builder{postings: make(map[string][]posting), carried: make(map[int]int)}
+}
+
+// Constructs a new Builder which updates the previous index, allowing the postings of
+// unchanged files to be carried over with Carry.
+func NewUpdateBuilder(previous *Index) *Builder {
+	b := NewBuilder()
+	b.previous = previous
+	return b
+}
+
+// Tokenises the contents of r, recording each token against the given file. Files must be
+// added one at a time.
+func (b *Builder) Add(file File, r io.Reader) error {
+	id := len(b.files)
+	b.files = append(b.files, file)
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		text, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		for _, t := range tokenPositions(text) {
+			b.postings[t.Text] = append(b.postings[t.Text], posting{File: id, Line: line, Position: t.Position})
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// Records the file as unchanged since it was indexed with the given id in the previous
+// index, so that its postings are carried over rather than being tokenised again.
+func (b *Builder) Carry(file File, previousID int) error {
+	if b.previous == nil {
+		return errors.New("there is no previous index to carry files over from")
+	}
+	b.carried[previousID] = len(b.files)
+	b.files = append(b.files, file)
+	return nil
+}
+
+// Copies the postings of the carried files from the previous index, and sorts all postings
+// by file, line and position, as required by the index's encoding.
+func (b *Builder) copyCarried() error {
+	if len(b.carried) > 0 {
+		err := b.previous.eachPosting(func(token string, p posting) {
+			if id, ok := b.carried[p.File]; ok {
+				b.postings[token] = append(b.postings[token], posting{File: id, Line: p.Line, Position: p.Position})
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, postings := range b.postings {
+		sort.Slice(postings, func(i, j int) bool {
+			if postings[i].File != postings[j].File {
+				return postings[i].File < postings[j].File
+			}
+			if postings[i].Line != postings[j].Line {
+				return postings[i].Line < postings[j].Line
+			}
+			return postings[i].Position < postings[j].Position
+		})
+	}
+	return nil
+}
+
+// Keeps track of the number of bytes written, so that the offsets of entries can be
+// recorded in the index's tables.
+type offsetWriter struct {
+	writer *bufio.Writer
+	offset uint64
+	buffer [binary.MaxVarintLen64]byte
+}
+
+func (w *offsetWriter) write(p []byte) error {
+	n, err := w.writer.Write(p)
+	w.offset += uint64(n)
+	return err
+}
+
+func (w *offsetWriter) writeUvarint(v uint64) error {
+	n := binary.PutUvarint(w.buffer[:], v)
+	return w.write(w.buffer[:n])
+}
+
+func (w *offsetWriter) writeString(s string) error {
+	if err := w.writeUvarint(uint64(len(s))); err != nil {
+		return err
+	}
+	return w.write([]byte(s))
+}
+
+func (w *offsetWriter) writeVarint(v int64) error {
+	n := binary.PutVarint(w.buffer[:], v)
+	return w.write(w.buffer[:n])
+}
+
+func (w *offsetWriter) writeUint64(v uint64) error {
+	binary.BigEndian.PutUint64(w.buffer[:8], v)
+	return w.write(w.buffer[:8])
+}
+
+// Writes the index to the given path. The index is written to a temporary file first, and
+// then renamed, so that an existing index is not left in a broken state if an error occurs.
+func (b *Builder) Write(path string) error {
+	temp := path + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp)
+	if err := b.write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+func (b *Builder) write(file *os.File) error {
+	if err := b.copyCarried(); err != nil {
+		return err
+	}
+	w := &offsetWriter{writer: bufio.NewWriter(file)}
+
+	// Leave space for the header, which is written once the offsets of the tables are known.
+	if err := w.write(make([]byte, headerLen)); err != nil {
+		return err
+	}
+
+	fileOffsets := []uint64{}
+	for _, f := range b.files {
+		fileOffsets = append(fileOffsets, w.offset)
+		if err := w.writeString(f.Repo); err != nil {
+			return err
+		}
+		if err := w.writeString(f.Path); err != nil {
+			return err
+		}
+		if err := w.writeString(f.InRepo); err != nil {
+			return err
+		}
+		if err := w.writeVarint(f.ModTime); err != nil {
+			return err
+		}
+		if err := w.writeVarint(f.Size); err != nil {
+			return err
+		}
+		if err := w.writeString(f.Hash); err != nil {
+			return err
+		}
+		if err := w.writeUvarint(uint64(len(f.Definitions))); err != nil {
+			return err
+		}
+		for _, definition := range f.Definitions {
+			if err := w.writeString(definition); err != nil {
+				return err
+			}
+		}
+	}
+	fileOffsets = append(fileOffsets, w.offset)
+
+	tokens := []string{}
+	for token := range b.postings {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	postingOffsets := []uint64{}
+	for _, token := range tokens {
+		postingOffsets = append(postingOffsets, w.offset)
+		previousFile := 0
+		for _, p := range b.postings[token] {
+			if err := w.writeUvarint(uint64(p.File - previousFile)); err != nil {
+				return err
+			}
+			if err := w.writeUvarint(uint64(p.Line)); err != nil {
+				return err
+			}
+			if err := w.writeUvarint(uint64(p.Position)); err != nil {
+				return err
+			}
+			previousFile = p.File
+		}
+	}
+	postingOffsets = append(postingOffsets, w.offset)
+
+	tokenOffsets := []uint64{}
+	for i, token := range tokens {
+		tokenOffsets = append(tokenOffsets, w.offset)
+		if err := w.writeString(token); err != nil {
+			return err
+		}
+		if err := w.writeUvarint(postingOffsets[i]); err != nil {
+			return err
+		}
+		if err := w.writeUvarint(postingOffsets[i+1] - postingOffsets[i]); err != nil {
+			return err
+		}
+	}
+	tokenOffsets = append(tokenOffsets, w.offset)
+
+	fileTable := w.offset
+	for _, offset := range fileOffsets {
+		if err := w.writeUint64(offset); err != nil {
+			return err
+		}
+	}
+	tokenTable := w.offset
+	for _, offset := range tokenOffsets {
+		if err := w.writeUint64(offset); err != nil {
+			return err
+		}
+	}
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+
+	header := make([]byte, headerLen)
+	copy(header, magic)
+	binary.BigEndian.PutUint64(header[8:], uint64(len(b.files)))
+	binary.BigEndian.PutUint64(header[16:], fileTable)
+	binary.BigEndian.PutUint64(header[24:], uint64(len(tokens)))
+	binary.BigEndian.PutUint64(header[32:], tokenTable)
+	_, err := file.WriteAt(header, 0)
+	return err
+}
+
+// Provides access to an index that has been written to disk by a Builder.
+type Index struct {
+	file       *os.File
+	fileCount  int
+	fileTable  int64
+	tokenCount int
+	tokenTable int64
+}
+
+// Opens the index at the given path, returning an error if it is not a valid index.
+func Open(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerLen)
+	if _, err := file.ReadAt(header, 0); err != nil || string(header[:7]) != string(magic[:7]) {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a depgrok index", path)
+	}
+	if header[7] != magic[7] {
+		file.Close()
+		return nil, fmt.Errorf("%s was written by a different version of depgrok, and must be rebuilt", path)
+	}
+	return &Index{
+		file:       file,
+		fileCount:  int(binary.BigEndian.Uint64(header[8:])),
+		fileTable:  int64(binary.BigEndian.Uint64(header[16:])),
+		tokenCount: int(binary.BigEndian.Uint64(header[24:])),
+		tokenTable: int64(binary.BigEndian.Uint64(header[32:])),
+	}, nil
+}
+
+// Closes the underlying index file.
+func (i *Index) Close() error {
+	return i.file.Close()
+}
+
+// Returns the number of files held in the index.
+func (i *Index) Len() int {
+	return i.fileCount
+}
+
+var errCorrupt = errors.New("the index is corrupt")
+
+// Reads the nth entry from the given table, returning its contents.
+func (i *Index) entry(table int64, n int) ([]byte, error) {
+	offsets := make([]byte, 16)
+	if _, err := i.file.ReadAt(offsets, table+int64(n)*8); err != nil {
+		return nil, err
+	}
+	start := binary.BigEndian.Uint64(offsets)
+	end := binary.BigEndian.Uint64(offsets[8:])
+	if end < start {
+		return nil, errCorrupt
+	}
+	contents := make([]byte, end-start)
+	if _, err := i.file.ReadAt(contents, int64(start)); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// Reads a length-prefixed string from the front of p, returning it along with the rest of p.
+func readString(p []byte) (string, []byte, error) {
+	length, n := binary.Uvarint(p)
+	if n <= 0 || uint64(len(p)-n) < length {
+		return "", nil, errCorrupt
+	}
+	return string(p[n : n+int(length)]), p[n+int(length):], nil
+}
+
+// Returns the file with the given id.
+func (i *Index) File(id int) (File, error) {
+	contents, err := i.entry(i.fileTable, id)
+	if err != nil {
+		return File{}, err
+	}
+	repo, rest, err := readString(contents)
+	if err != nil {
+		return File{}, err
+	}
+	path, rest, err := readString(rest)
+	if err != nil {
+		return File{}, err
+	}
+	inRepo, rest, err := readString(rest)
+	if err != nil {
+		return File{}, err
+	}
+	modTime, n1 := binary.Varint(rest)
+	if n1 <= 0 {
+		return File{}, errCorrupt
+	}
+	size, n2 := binary.Varint(rest[n1:])
+	if n2 <= 0 {
+		return File{}, errCorrupt
+	}
+	hash, rest, err := readString(rest[n1+n2:])
+	if err != nil {
+		return File{}, err
+	}
+	count, n3 := binary.Uvarint(rest)
+	if n3 <= 0 || count > uint64(len(rest)) {
+		return File{}, errCorrupt
+	}
+	rest = rest[n3:]
+	var definitions []string
+	for n := uint64(0); n < count; n++ {
+		var definition string
+		definition, rest, err = readString(rest)
+		if err != nil {
+			return File{}, err
+		}
+		definitions = append(definitions, definition)
+	}
+	return File{Repo: repo, Path: path, InRepo: inRepo, ModTime: modTime, Size: size, Hash: hash, Definitions: definitions}, nil
+}
+
+// Returns all of the files held in the index, in order of their ids.
+func (i *Index) Files() ([]File, error) {
+	files := []File{}
+	for id := 0; id < i.fileCount; id++ {
+		file, err := i.File(id)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// Reads the token entry at position n in the token table, returning the token and the
+// offset and length of its postings.
+func (i *Index) token(n int) (string, uint64, uint64, error) {
+	contents, err := i.entry(i.tokenTable, n)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	token, rest, err := readString(contents)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	offset, n1 := binary.Uvarint(rest)
+	if n1 <= 0 {
+		return "", 0, 0, errCorrupt
+	}
+	length, n2 := binary.Uvarint(rest[n1:])
+	if n2 <= 0 {
+		return "", 0, 0, errCorrupt
+	}
+	return token, offset, length, nil
+}
+
+// Returns the postings for the given token, found by binary searching the token table.
+func (i *Index) postings(token string) ([]posting, error) {
+	var searchErr error
+	n := sort.Search(i.tokenCount, func(n int) bool {
+		candidate, _, _, err := i.token(n)
+		if err != nil && searchErr == nil {
+			searchErr = err
+		}
+		return candidate >= token
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+	if n == i.tokenCount {
+		return nil, nil
+	}
+	candidate, offset, length, err := i.token(n)
+	if err != nil {
+		return nil, err
+	}
+	if candidate != token {
+		return nil, nil
+	}
+
+	contents := make([]byte, length)
+	if _, err := i.file.ReadAt(contents, int64(offset)); err != nil {
+		return nil, err
+	}
+	return decodePostings(contents)
+}
+
+// Decodes a token's postings, as written by Builder.Write.
+func decodePostings(contents []byte) ([]posting, error) {
+	postings := []posting{}
+	file := 0
+	for len(contents) > 0 {
+		fileDelta, n1 := binary.Uvarint(contents)
+		if n1 <= 0 {
+			return nil, errCorrupt
+		}
+		line, n2 := binary.Uvarint(contents[n1:])
+		if n2 <= 0 {
+			return nil, errCorrupt
+		}
+		position, n3 := binary.Uvarint(contents[n1+n2:])
+		if n3 <= 0 {
+			return nil, errCorrupt
+		}
+		file += int(fileDelta)
+		postings = append(postings, posting{File: file, Line: int(line), Position: int(position)})
+		contents = contents[n1+n2+n3:]
+	}
+	return postings, nil
+}
+
+// Calls fn with every posting of every token in the index. The token table, tokens and
+// postings are each read in a single pass, rather than an entry at a time.
+func (i *Index) eachPosting(fn func(token string, p posting)) error {
+	if i.tokenCount == 0 {
+		return nil
+	}
+	table := make([]byte, (i.tokenCount+1)*8)
+	if _, err := i.file.ReadAt(table, i.tokenTable); err != nil {
+		return err
+	}
+	tokensStart := binary.BigEndian.Uint64(table)
+	tokens := make([]byte, binary.BigEndian.Uint64(table[len(table)-8:])-tokensStart)
+	if _, err := i.file.ReadAt(tokens, int64(tokensStart)); err != nil {
+		return err
+	}
+
+	// The postings sit between the end of the file entries and the start of the tokens.
+	fileTableEnd := make([]byte, 8)
+	if _, err := i.file.ReadAt(fileTableEnd, i.fileTable+int64(i.fileCount)*8); err != nil {
+		return err
+	}
+	postingsStart := binary.BigEndian.Uint64(fileTableEnd)
+	if postingsStart > tokensStart {
+		return errCorrupt
+	}
+	postings := make([]byte, tokensStart-postingsStart)
+	if _, err := i.file.ReadAt(postings, int64(postingsStart)); err != nil {
+		return err
+	}
+
+	for len(tokens) > 0 {
+		token, rest, err := readString(tokens)
+		if err != nil {
+			return err
+		}
+		offset, n1 := binary.Uvarint(rest)
+		if n1 <= 0 {
+			return errCorrupt
+		}
+		length, n2 := binary.Uvarint(rest[n1:])
+		if n2 <= 0 {
+			return errCorrupt
+		}
+		tokens = rest[n1+n2:]
+		start := offset - postingsStart
+		if offset < postingsStart || start+length > uint64(len(postings)) {
+			return errCorrupt
+		}
+		decoded, err := decodePostings(postings[start : start+length])
+		if err != nil {
+			return err
+		}
+		for _, p := range decoded {
+			fn(token, p)
+		}
+	}
+	return nil
+}
+
+// Returns the location of each line referencing the given name. Names made up of more than
+// one identifier (e.g. `dbo.orders`) are found on lines containing all of their identifiers
+// one after another, e.g. `dbo.orders` or `[dbo].[orders]`, but not `dbo x orders`.
+func (i *Index) Lookup(name string) ([]Location, error) {
+	tokens := nameTokens(name)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	postings, err := i.postings(tokens[0])
+	if err != nil {
+		return nil, err
+	}
+	// Each posting of the first identifier is kept if each of the others follows it.
+	for n, token := range tokens[1:] {
+		others, err := i.postings(token)
+		if err != nil {
+			return nil, err
+		}
+		found := map[posting]bool{}
+		for _, p := range others {
+			found[p] = true
+		}
+		remaining := []posting{}
+		for _, p := range postings {
+			if found[posting{File: p.File, Line: p.Line, Position: p.Position + n + 1}] {
+				remaining = append(remaining, p)
+			}
+		}
+		postings = remaining
+	}
+
+	files := map[int]File{}
+	locations := []Location{}
+	lines := map[posting]bool{}
+	for _, p := range postings {
+		// A line referencing the name more than once is only returned once.
+		line := posting{File: p.File, Line: p.Line}
+		if lines[line] {
+			continue
+		}
+		lines[line] = true
+		file, ok := files[p.File]
+		if !ok {
+			file, err = i.File(p.File)
+			if err != nil {
+				return nil, err
+			}
+			files[p.File] = file
+		}
+		locations = append(locations, Location{Repo: file.Repo, Path: file.Path, InRepo: file.InRepo, Line: p.Line, Definitions: file.Definitions})
+	}
+	return locations, nil
+}
@@ -0,0 +1,226 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenise_ShouldSplitIdentifiers(t *testing.T) {
+	tokens := Tokenise("SELECT * FROM dbo.orders WHERE id = 1")
+
+	assert.Equal(t, []string{"SELECT", "FROM", "dbo", "orders", "WHERE", "id", "1"}, tokens)
+}
+
+func TestTokenise_ShouldIncludePartsOfIdentifiers(t *testing.T) {
+	tokens := Tokenise("orders_archive2")
+
+	assert.ElementsMatch(t, []string{"orders_archive2", "orders", "archive2", "archive"}, tokens)
+}
+
+func TestTokenise_ShouldReturnEachTokenOnce(t *testing.T) {
+	tokens := Tokenise("foo foo.foo")
+
+	assert.Equal(t, []string{"foo"}, tokens)
+}
+
+// Builds an index of the given files, returning it along with a function to clean it up.
+func buildIndex(t *testing.T, files map[string]string) (*Index, func()) {
+	dir, err := ioutil.TempDir("", "depgrok-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := NewBuilder()
+	for _, path := range []string{"repo1/a.sql", "repo1/b.cs", "repo2/c.cs"} {
+		contents, ok := files[path]
+		if !ok {
+			continue
+		}
+		repo := strings.Split(path, "/")[0]
+		if err := builder.Add(File{Repo: repo, Path: path}, strings.NewReader(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "depgrok.index")
+	if err := builder.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idx, func() {
+		idx.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestIndexLookup_ShouldReturnLocations(t *testing.T) {
+	idx, cleanup := buildIndex(t, map[string]string{
+		"repo1/a.sql": "select *\nfrom orders\n",
+		"repo1/b.cs":  "var x = 1;\n",
+		"repo2/c.cs":  "// orders\nGetOrders(orders);",
+	})
+	defer cleanup()
+
+	locations, err := idx.Lookup("orders")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Location{
+		{Repo: "repo1", Path: "repo1/a.sql", Line: 2},
+		{Repo: "repo2", Path: "repo2/c.cs", Line: 1},
+		{Repo: "repo2", Path: "repo2/c.cs", Line: 2},
+	}, locations)
+	assert.Equal(t, 3, idx.Len())
+}
+
+func TestIndexLookup_ShouldReturnNothingForUnknownToken(t *testing.T) {
+	idx, cleanup := buildIndex(t, map[string]string{"repo1/a.sql": "select * from orders"})
+	defer cleanup()
+
+	for _, name := range []string{"aaa", "order", "ordersx", "zzz", ""} {
+		locations, err := idx.Lookup(name)
+
+		assert.Nil(t, err)
+		assert.Empty(t, locations, name)
+	}
+}
+
+func TestIndexLookup_ShouldRequireAllIdentifiersOnTheSameLine(t *testing.T) {
+	idx, cleanup := buildIndex(t, map[string]string{
+		"repo1/a.sql": "from dbo.orders\nfrom sales.orders\n",
+		"repo1/b.cs":  "dbo\norders\n",
+	})
+	defer cleanup()
+
+	locations, err := idx.Lookup("dbo.orders")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Location{{Repo: "repo1", Path: "repo1/a.sql", Line: 1}}, locations)
+}
+
+func TestIndexLookup_ShouldRequireIdentifiersToFollowEachOther(t *testing.T) {
+	idx, cleanup := buildIndex(t, map[string]string{
+		"repo1/a.sql": "from dbo x orders\nfrom [dbo].[orders] join dbo.orders\nfrom dbo_orders\n",
+	})
+	defer cleanup()
+
+	locations, err := idx.Lookup("dbo.orders")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Location{{Repo: "repo1", Path: "repo1/a.sql", Line: 2}}, locations)
+}
+
+func TestOpen_ShouldRejectFilesThatAreNotIndexes(t *testing.T) {
+	file, err := ioutil.TempFile("", "depgrok-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("this is not an index, but it is long enough to have a header")
+	file.Close()
+
+	_, err = Open(file.Name())
+
+	assert.NotNil(t, err)
+}
+
+func TestFileUnchanged(t *testing.T) {
+	previous := File{Repo: "repo1", Path: "repo1/a.sql", ModTime: 1, Size: 10, Hash: "abc"}
+
+	assert.True(t, File{Repo: "repo1", Path: "repo1/a.sql", ModTime: 2, Size: 10, Hash: "abc"}.Unchanged(previous),
+		"Files with the same hash should be unchanged, regardless of modification time")
+	assert.False(t, File{Repo: "repo1", Path: "repo1/a.sql", ModTime: 1, Size: 10, Hash: "def"}.Unchanged(previous),
+		"Files with different hashes should be changed")
+	assert.False(t, File{Repo: "repo1", Path: "repo1/a.sql", ModTime: 1, Size: 11, Hash: "abc"}.Unchanged(previous),
+		"Files with different sizes should be changed")
+	assert.True(t, File{Repo: "repo1", Path: "repo1/a.sql", ModTime: 1, Size: 10}.Unchanged(previous),
+		"Files without a hash should be compared by modification time")
+	assert.False(t, File{Repo: "repo1", Path: "repo1/a.sql", ModTime: 2, Size: 10}.Unchanged(previous),
+		"Files without a hash should be compared by modification time")
+}
+
+func TestUpdateBuilder_ShouldCarryPostingsOfUnchangedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "depgrok-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "depgrok.index")
+
+	builder := NewBuilder()
+	builder.Add(File{Repo: "repo1", Path: "repo1/a.sql", Size: 1}, strings.NewReader("orders\n"))
+	builder.Add(File{Repo: "repo1", Path: "repo1/b.sql", Size: 1}, strings.NewReader("customers\n"))
+	builder.Add(File{Repo: "repo2", Path: "repo2/c.sql", Size: 1}, strings.NewReader("\norders\n"))
+	if err := builder.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rebuild the index with a.sql changed, b.sql removed and c.sql unchanged, placing
+	// c.sql before a.sql to check that postings are re-ordered correctly.
+	previous, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := previous.Files()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(files))
+	builder = NewUpdateBuilder(previous)
+	assert.Nil(t, builder.Carry(files[2], 2))
+	builder.Add(File{Repo: "repo1", Path: "repo1/a.sql", Size: 2}, strings.NewReader("customers orders\n"))
+	if err := builder.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	previous.Close()
+
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	orders, err := idx.Lookup("orders")
+	assert.Nil(t, err)
+	assert.Equal(t, []Location{
+		{Repo: "repo2", Path: "repo2/c.sql", Line: 2},
+		{Repo: "repo1", Path: "repo1/a.sql", Line: 1},
+	}, orders)
+	customers, err := idx.Lookup("customers")
+	assert.Nil(t, err)
+	assert.Equal(t, []Location{{Repo: "repo1", Path: "repo1/a.sql", Line: 1}}, customers)
+	file, err := idx.File(1)
+	assert.Nil(t, err)
+	assert.Equal(t, File{Repo: "repo1", Path: "repo1/a.sql", Size: 2}, file)
+}
+
+func TestIndexLookup_ShouldReturnTheDefinitionsOfFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "depgrok-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "depgrok.index")
+	builder := NewBuilder()
+	builder.Add(File{Repo: "repo1", Path: "repo1/a.sql", Definitions: []string{"usp_GetOrders", "dbo.vw_Orders"}}, strings.NewReader("select * from orders\n"))
+	builder.Add(File{Repo: "repo2", Path: "repo2/b.cs"}, strings.NewReader("orders\n"))
+	if err := builder.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	locations, err := idx.Lookup("orders")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Location{
+		{Repo: "repo1", Path: "repo1/a.sql", Line: 1, Definitions: []string{"usp_GetOrders", "dbo.vw_Orders"}},
+		{Repo: "repo2", Path: "repo2/b.cs", Line: 1},
+	}, locations)
+}
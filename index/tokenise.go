@@ -0,0 +1,103 @@
+package index
+
+// Tokens longer than this are not indexed, which keeps the entries in the token table
+// small enough to be read in one go.
+const maxTokenLen = 128
+
+func isLetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+func isIdentifier(b byte) bool {
+	return isLetter(b) || (b >= '0' && b <= '9') || b == '_'
+}
+
+// Splits text into identifiers (runs of letters, digits and underscores). Where an
+// identifier contains characters other than letters, its underscore-separated parts and
+// runs of letters are also returned as tokens, so that a name like `orders` can be found
+// in `orders_archive` or `orders2`, as it would be by a search. Each token is only
+// returned once.
+func Tokenise(text string) []string {
+	tokens := []string{}
+	seen := map[string]bool{}
+	for _, t := range tokenPositions(text) {
+		if !seen[t.Text] {
+			seen[t.Text] = true
+			tokens = append(tokens, t.Text)
+		}
+	}
+	return tokens
+}
+
+// Represents a token found in some text, along with the position of the identifier it was
+// found in, counting the identifiers of the text from 0.
+type token struct {
+	Text     string
+	Position int
+}
+
+// Splits text into tokens as per Tokenise, along with their positions, so that the
+// identifiers of a qualified name can be checked to appear one after another. Each token is
+// only returned once per position.
+func tokenPositions(text string) []token {
+	tokens := []token{}
+	position := -1
+	seen := map[string]bool{}
+	add := func(text string) {
+		if text == "" || len(text) > maxTokenLen || seen[text] {
+			return
+		}
+		seen[text] = true
+		tokens = append(tokens, token{Text: text, Position: position})
+	}
+	for i := 0; i < len(text); {
+		if !isIdentifier(text[i]) {
+			i++
+			continue
+		}
+		start := i
+		lettersOnly := true
+		for i < len(text) && isIdentifier(text[i]) {
+			lettersOnly = lettersOnly && isLetter(text[i])
+			i++
+		}
+		identifier := text[start:i]
+		position++
+		seen = map[string]bool{}
+		add(identifier)
+		if lettersOnly {
+			continue
+		}
+		for _, split := range []func(byte) bool{
+			func(b byte) bool { return b == '_' },
+			func(b byte) bool { return !isLetter(b) },
+		} {
+			partStart := 0
+			for j := 0; j <= len(identifier); j++ {
+				if j == len(identifier) || split(identifier[j]) {
+					add(identifier[partStart:j])
+					partStart = j + 1
+				}
+			}
+		}
+	}
+	return tokens
+}
+
+// Splits a dependency name into the identifiers that must appear one after another on a
+// line for the name to be referenced.
+func nameTokens(name string) []string {
+	tokens := []string{}
+	for i := 0; i < len(name); {
+		if !isIdentifier(name[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(name) && isIdentifier(name[i]) {
+			i++
+		}
+		tokens = append(tokens, name[start:i])
+	}
+	return tokens
+}
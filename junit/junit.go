@@ -0,0 +1,80 @@
+// Package junit renders the violations found by checking rules against a search as JUnit
+// XML, so that CI systems which only understand test results can show them.
+package junit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andykuszyk/depgrok/search"
+)
+
+// Represents the root element of a JUnit XML report, holding a test suite for each rule.
+type TestSuites struct {
+	XMLName  struct{}    `xml:"testsuites"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Suites   []TestSuite `xml:"testsuite"`
+}
+
+// Represents a rule within a JUnit XML report, holding a test case for each repo that the
+// rule applies to.
+type TestSuite struct {
+	Name     string     `xml:"name,attr"`
+	Tests    int        `xml:"tests,attr"`
+	Failures int        `xml:"failures,attr"`
+	Cases    []TestCase `xml:"testcase"`
+}
+
+// Represents a rule checked against a repo, which fails if the repo violates the rule.
+type TestCase struct {
+	Name      string   `xml:"name,attr"`
+	ClassName string   `xml:"classname,attr"`
+	Failure   *Failure `xml:"failure,omitempty"`
+}
+
+// Represents the violations of a rule by a repo, with the reason for, and location of,
+// each violation as its text.
+type Failure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// Returns the JUnit XML report of the violations of the rules, with a test suite for each
+// rule, and a test case for each of the repos searched that the rule applies to. A test
+// case fails if its repo violated its rule.
+func FromViolations(rules search.Rules, repos []string, violations []search.Violation) TestSuites {
+	suites := TestSuites{Name: "depgrok", Suites: []TestSuite{}}
+	for _, rule := range rules.Rules {
+		suite := TestSuite{Name: rule.Name, Cases: []TestCase{}}
+		for _, repo := range repos {
+			if !rule.AppliesTo(repo) {
+				continue
+			}
+			testCase := TestCase{Name: repo, ClassName: rule.Name}
+			lines := []string{}
+			for _, violation := range violations {
+				if violation.Rule == rule.Name && violation.Reference.Repo == repo {
+					lines = append(lines, fmt.Sprintf("%s at %s:%d:%d", violation.Reason,
+						violation.Reference.Path, violation.Reference.Line, violation.Reference.Column))
+				}
+			}
+			if len(lines) > 0 {
+				testCase.Failure = &Failure{
+					Message: fmt.Sprintf("%d violations of %s", len(lines), rule.Name),
+					Type:    "violation",
+					Text:    strings.Join(lines, "\n"),
+				}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+			suite.Tests++
+		}
+		suites.Suites = append(suites.Suites, suite)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+	}
+	return suites
+}
@@ -0,0 +1,45 @@
+package junit
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/andykuszyk/depgrok/search"
+	"github.com/stretchr/testify/assert"
+)
+
+func checked() TestSuites {
+	rules := search.Rules{Rules: []search.Rule{
+		{Name: "no payments", Repos: []string{"frontend-*"}, MustNotReference: []string{"payments.*"}},
+		{Name: "no legacy", NoNewReferences: []string{"legacy_*"}},
+	}}
+	violations := []search.Violation{{
+		Rule:      "no payments",
+		Reason:    "frontend-web must not reference payments.cards",
+		Reference: search.ReportReference{Dependency: "payments.cards", Repo: "frontend-web", Path: "cart.js", Line: 3, Column: 9},
+	}}
+	return FromViolations(rules, []string{"backend-api", "frontend-web"}, violations)
+}
+
+func TestFromViolations_ShouldHaveATestCasePerRulePerRepo(t *testing.T) {
+	suites := checked()
+
+	assert.Equal(t, 3, suites.Tests)
+	assert.Equal(t, 1, suites.Failures)
+	assert.Len(t, suites.Suites[0].Cases, 1)
+	assert.Len(t, suites.Suites[1].Cases, 2)
+	assert.Nil(t, suites.Suites[1].Cases[0].Failure)
+	assert.Equal(t, &Failure{
+		Message: "1 violations of no payments",
+		Type:    "violation",
+		Text:    "frontend-web must not reference payments.cards at cart.js:3:9",
+	}, suites.Suites[0].Cases[0].Failure)
+}
+
+func TestFromViolations_ShouldBeWrittenAsJUnitXML(t *testing.T) {
+	contents, err := xml.Marshal(checked())
+
+	assert.Nil(t, err)
+	assert.Contains(t, string(contents), `<testsuites name="depgrok" tests="3" failures="1"><testsuite name="no payments" tests="1" failures="1">`)
+	assert.Contains(t, string(contents), `<testcase name="backend-api" classname="no legacy"></testcase>`)
+}
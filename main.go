@@ -4,6 +4,7 @@ import (
 	"github.com/andykuszyk/depgrok/commands"
 	"github.com/urfave/cli"
 	"os"
+	"runtime"
 )
 
 func main() {
@@ -51,9 +52,16 @@ func main() {
 					Usage: "The depth of the dependency tree to construct. E.g. a value of 1 (the default)" +
 						" will result in direct dependency relationships being found (X depends on Y, " +
 						" or X -> Y). A value of 2 results in direct relationships, with one dependency" +
-						" in common being found (X depends on Z, via Y, or X -> Y -> Z).",
+						" in common being found (X depends on Z, via Y, or X -> Y -> Z). A value of 0" +
+						" searches level after level until no new dependencies are found.",
 					Value: 1,
 				},
+				cli.IntFlag{
+					Name: "max-depth",
+					Usage: "The most levels searched with a --depth of 0, after which the search is stopped" +
+						" even if there are dependencies still to search for",
+					Value: 10,
+				},
 				cli.StringSliceFlag{
 					Name:  "exclude",
 					Usage: "A glob or file to exclude from the dependency search, e.g. *.md. If this option" +
@@ -66,13 +74,479 @@ func main() {
 						" is set, only files that match the glob will be searched, at the exclusion of all " +
 						"others. Cannot be used in conjunction with --exclude",
 				},
+				cli.StringFlag{
+					Name: "unit",
+					Usage: "What the files searched are attributed to: repo (the default), module, which" +
+						" divides monorepos into their Go modules, npm packages, .NET projects, Maven and" +
+						" Gradle modules, Rust crates and Python projects, or directory:N, which attributes" +
+						" files to the directory N levels beneath --dir",
+					Value: "repo",
+				},
+				cli.IntFlag{
+					Name: "repo-depth",
+					Usage: "The number of directories beneath --dir that make up the path of each repo, e.g. 2" +
+						" for a layout of team/repo. By default, repos are found at any depth by their .git" +
+						" directories (and --repo-markers), falling back to the immediate children of --dir",
+				},
+				cli.StringSliceFlag{
+					Name: "repo-markers",
+					Usage: "The name or glob of a file that marks the root of a repo, in addition to .git," +
+						" e.g. go.mod or *.csproj, so that projects within a monorepo are reported separately",
+				},
+				cli.StringFlag{
+					Name: "ref",
+					Usage: "A branch, tag or commit to search in each repo, which is read from the repo's git" +
+						" history rather than its working tree, e.g. main. Repos without the ref are skipped",
+				},
+				cli.BoolFlag{
+					Name: "archives",
+					Usage: "Searches the entries of zip, jar, war, ear, nupkg and tar.gz archives as if they" +
+						" were files in the repo, reporting them as archive!/entry",
+				},
+				cli.StringFlag{
+					Name: "matcher",
+					Usage: "The matcher used to find references to dependencies: word (the default), regex, sql," +
+						" case-insensitive or token. A dependency can be given its own matcher with a suffix," +
+						" e.g. --deps 'orders:sql'",
+					Value: "word",
+				},
+				cli.StringSliceFlag{
+					Name: "matcher-for",
+					Usage: "A glob and the matcher to use by default for files that match it, e.g. *.sql=sql." +
+						" The first glob that matches a file is used, falling back to --matcher",
+				},
+				cli.BoolFlag{
+					Name: "file-names-only",
+					Usage: "When searching beyond the first level, searches for the names of the files found" +
+						" at the previous level, rather than the entities they define, such as the procedures" +
+						" created by SQL scripts or the classes declared in C# and Java files",
+				},
+				cli.StringSliceFlag{
+					Name: "stop-name",
+					Usage: "A file name (without its extension) or glob that should not become a dependency" +
+						" when searching beyond the first level, in addition to the built-in stop list of" +
+						" common names such as app, index, main, Program and README",
+				},
+				cli.BoolFlag{
+					Name:  "no-default-stop-names",
+					Usage: "Leaves out the built-in stop list, so that only the names given by --stop-name are stopped",
+				},
+				cli.IntFlag{
+					Name:  "min-name-length",
+					Usage: "The minimum length of a file name that can become a dependency when searching beyond the first level",
+					Value: 3,
+				},
+				cli.Float64Flag{
+					Name: "min-name-entropy",
+					Usage: "The entropy, in bits per character, that a file name must exceed to become a" +
+						" dependency when searching beyond the first level, which stops repetitive names such" +
+						" as aaa or abab. 0 turns the check off",
+					Value: 1,
+				},
+				cli.IntFlag{
+					Name: "workers",
+					Usage: "The number of files to search in parallel. Defaults to the number of CPUs",
+					Value: runtime.NumCPU(),
+				},
+				cli.IntFlag{
+					Name: "cache-mb",
+					Usage: "The number of megabytes of file contents to hold in memory between levels of" +
+						" the search. Files that do not fit are re-read from disk for each level beyond" +
+						" the first. 0 holds none in memory.",
+					Value: 256,
+				},
+				cli.StringFlag{
+					Name: "format",
+					Usage: "The format of the output: text (the default), which lists each dependency chain" +
+						" found followed by any cycles, json, which also includes the location of every" +
+						" reference, or sarif, which reports every reference as a SARIF 2.1.0 result",
+					Value: "text",
+				},
+				cli.StringFlag{
+					Name: "save",
+					Usage: "A file to save a snapshot of the result to, as JSON, which can later be compared" +
+						" with another snapshot, or a fresh search, by the diff command",
+				},
 				cli.BoolFlag{
 					Name: "debug",
 					Usage: "Prints additional debug information to stderr",
 				},
 			},
 		},
+		{
+			Name: "history",
+			Usage: "Searches a directory of code repositories for references to entities, as per the search" +
+				" command, reporting the commit, author and date that introduced each reference found",
+			Action: commands.History,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "deps",
+					Usage: "The dependencies to search for, provided as a white-space separated list",
+				},
+				cli.StringFlag{
+					Name:  "dir",
+					Usage: "The directory containing code repositories, in which to search",
+				},
+				cli.IntFlag{
+					Name:  "depth",
+					Usage: "The depth of the dependency tree to construct, as per the search command",
+					Value: 1,
+				},
+				cli.IntFlag{
+					Name:  "max-depth",
+					Usage: "The most levels searched with a --depth of 0, as per the search command",
+					Value: 10,
+				},
+				cli.BoolFlag{
+					Name: "removed",
+					Usage: "Also reports the files that used to reference each dependency, but no longer do," +
+						" along with the commit that removed the reference",
+				},
+			}, searchFlags()...),
+		},
+		{
+			Name: "path",
+			Usage: "Searches a directory of code repositories for references to entities, as per the search" +
+				" command, reporting the shortest chain of references from a repo to a dependency, along" +
+				" with the file responsible for each hop",
+			Action: commands.Path,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "from",
+					Usage: "The repo the chain of references starts from, e.g. org/team/repo",
+				},
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "The name of the dependency the chain of references ends at",
+				},
+				cli.StringFlag{
+					Name:  "deps",
+					Usage: "The dependencies to search for, provided as a white-space separated list. Defaults to --to",
+				},
+				cli.StringFlag{
+					Name:  "dir",
+					Usage: "The directory containing code repositories, in which to search",
+				},
+				cli.BoolFlag{
+					Name:  "all",
+					Usage: "Reports every chain of references from --from to --to, rather than only the shortest",
+				},
+				cli.IntFlag{
+					Name:  "max-length",
+					Usage: "The most references in a chain reported by --all",
+					Value: 10,
+				},
+				cli.IntFlag{
+					Name: "depth",
+					Usage: "The depth of the dependency tree to construct, as per the search command. Defaults" +
+						" to 0, which searches until no new dependencies are found",
+				},
+				cli.IntFlag{
+					Name:  "max-depth",
+					Usage: "The most levels searched with a --depth of 0, as per the search command",
+					Value: 10,
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "The format of the output: text or json",
+					Value: "text",
+				},
+			}, searchFlags()...),
+		},
+		{
+			Name: "stats",
+			Usage: "Searches a directory of code repositories for references to entities, as per the search" +
+				" command, reporting the number of repos that reach each dependency, directly and" +
+				" transitively, along with a ranking of the dependencies by how central they are",
+			Action: commands.Stats,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "deps",
+					Usage: "The dependencies to search for, provided as a white-space separated list",
+				},
+				cli.StringFlag{
+					Name:  "dir",
+					Usage: "The directory containing code repositories, in which to search",
+				},
+				cli.IntFlag{
+					Name: "depth",
+					Usage: "The depth of the dependency tree to construct, as per the search command. Defaults" +
+						" to 0, which searches until no new dependencies are found",
+				},
+				cli.IntFlag{
+					Name:  "max-depth",
+					Usage: "The most levels searched with a --depth of 0, as per the search command",
+					Value: 10,
+				},
+				cli.IntFlag{
+					Name:  "top",
+					Usage: "The number of dependencies to include in the ranking. Defaults to 0, which includes all of them",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "The format of the output: text or json",
+					Value: "text",
+				},
+			}, searchFlags()...),
+		},
+		{
+			Name: "diff",
+			Usage: "Compares a snapshot saved by the search command's --save flag with another snapshot," +
+				" or with a fresh search, listing the repos, edges and references added or removed",
+			Action: commands.Diff,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "before",
+					Usage: "The snapshot to compare from",
+				},
+				cli.StringFlag{
+					Name: "after",
+					Usage: "The snapshot to compare to. If this option is not set, the repos in --dir are" +
+						" searched again, as per the search command, and the result is compared to instead",
+				},
+				cli.StringFlag{
+					Name:  "deps",
+					Usage: "The dependencies to search for without --after. Defaults to those of the --before snapshot",
+				},
+				cli.StringFlag{
+					Name:  "dir",
+					Usage: "The directory containing code repositories, in which to search without --after",
+				},
+				cli.IntFlag{
+					Name:  "depth",
+					Usage: "The depth of the dependency tree to construct without --after, as per the search command",
+					Value: 1,
+				},
+				cli.IntFlag{
+					Name:  "max-depth",
+					Usage: "The most levels searched with a --depth of 0, as per the search command",
+					Value: 10,
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "The format of the output: text or json",
+					Value: "text",
+				},
+			}, searchFlags()...),
+		},
+		{
+			Name: "check",
+			Usage: "Searches a directory of code repositories for references to entities, as per the search" +
+				" command, then checks the result against the rules of a rules file, reporting any" +
+				" violations and exiting with a non-zero status if there are any",
+			Action: commands.Check,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "rules",
+					Usage: "The JSON file containing the rules to check, as described in the README",
+				},
+				cli.StringFlag{
+					Name: "baseline",
+					Usage: "A snapshot saved by the search command's --save flag, beyond which rules with" +
+						" noNewReferences do not allow any new references",
+				},
+				cli.StringFlag{
+					Name:  "deps",
+					Usage: "The dependencies to search for, provided as a white-space separated list. Defaults to those of --baseline",
+				},
+				cli.StringFlag{
+					Name:  "dir",
+					Usage: "The directory containing code repositories, in which to search",
+				},
+				cli.IntFlag{
+					Name:  "depth",
+					Usage: "The depth of the dependency tree to construct, as per the search command",
+					Value: 1,
+				},
+				cli.IntFlag{
+					Name:  "max-depth",
+					Usage: "The most levels searched with a --depth of 0, as per the search command",
+					Value: 10,
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "The format of the output: text, json, sarif or junit",
+					Value: "text",
+				},
+			}, searchFlags()...),
+		},
+		{
+			Name: "index",
+			Usage: "Tokenises every file in a directory of code repositories into an index on disk, which" +
+				" can be searched quickly and repeatedly using the query command",
+			Action: commands.Index,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "dir",
+					Usage: "The directory containing code repositories, which should be indexed",
+				},
+				cli.StringFlag{
+					Name:  "index",
+					Usage: "The path of the index file to write",
+					Value: "depgrok.index",
+				},
+				cli.BoolFlag{
+					Name: "full",
+					Usage: "Rebuilds the index from scratch, rather than only re-indexing the files that" +
+						" have changed since the index was last written",
+				},
+				cli.StringSliceFlag{
+					Name: "exclude",
+					Usage: "A glob or file to exclude from the index, e.g. *.md. Cannot be used in" +
+						" conjunction with --include",
+				},
+				cli.StringSliceFlag{
+					Name: "include",
+					Usage: "A glob or file to include in the index, e.g. *.cs. Cannot be used in" +
+						" conjunction with --exclude",
+				},
+				cli.StringFlag{
+					Name:  "unit",
+					Usage: "What the files searched are attributed to: repo, module or directory:N, as per the search command",
+					Value: "repo",
+				},
+				cli.IntFlag{
+					Name:  "repo-depth",
+					Usage: "The number of directories beneath --dir that make up the path of each repo, as per the search command",
+				},
+				cli.StringSliceFlag{
+					Name:  "repo-markers",
+					Usage: "The name or glob of a file that marks the root of a repo, as per the search command",
+				},
+				cli.BoolFlag{
+					Name:  "debug",
+					Usage: "Prints additional debug information to stderr",
+				},
+			},
+		},
+		{
+			Name: "query",
+			Usage: "Searches an index written by the index command for references to entities, returning " +
+				"those repositories that match, directly or indirectly",
+			Action: commands.Query,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "deps",
+					Usage: "The dependencies to search for, provided as a white-space separated list",
+				},
+				cli.StringFlag{
+					Name:  "index",
+					Usage: "The path of the index file to query",
+					Value: "depgrok.index",
+				},
+				cli.IntFlag{
+					Name:  "depth",
+					Usage: "The depth of the dependency tree to construct, as per the search command",
+					Value: 1,
+				},
+				cli.IntFlag{
+					Name:  "max-depth",
+					Usage: "The most levels searched with a --depth of 0, as per the search command",
+					Value: 10,
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "The format of the output: text, json or sarif, as per the search command",
+					Value: "text",
+				},
+				cli.BoolFlag{
+					Name:  "file-names-only",
+					Usage: "Searches for the names of the files found at the previous level, as per the search command",
+				},
+				cli.StringSliceFlag{
+					Name:  "stop-name",
+					Usage: "A file name or glob that should not become a dependency, as per the search command",
+				},
+				cli.BoolFlag{
+					Name:  "no-default-stop-names",
+					Usage: "Leaves out the built-in stop list, as per the search command",
+				},
+				cli.IntFlag{
+					Name:  "min-name-length",
+					Usage: "The minimum length of a file name that can become a dependency, as per the search command",
+					Value: 3,
+				},
+				cli.Float64Flag{
+					Name:  "min-name-entropy",
+					Usage: "The entropy that a file name must exceed to become a dependency, as per the search command",
+					Value: 1,
+				},
+			},
+		},
 	}
 
 	app.Run(os.Args)
 }
+
+// Returns the flags shared by the commands that run a search as per the search command,
+// beyond those that select what is searched for and where.
+func searchFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "exclude",
+			Usage: "A glob or file to exclude from the dependency search, as per the search command",
+		},
+		cli.StringSliceFlag{
+			Name:  "include",
+			Usage: "A glob or file to include in the dependency search, as per the search command",
+		},
+		cli.StringFlag{
+			Name:  "unit",
+			Usage: "What the files searched are attributed to: repo, module or directory:N, as per the search command",
+			Value: "repo",
+		},
+		cli.IntFlag{
+			Name:  "repo-depth",
+			Usage: "The number of directories beneath --dir that make up the path of each repo, as per the search command",
+		},
+		cli.StringSliceFlag{
+			Name:  "repo-markers",
+			Usage: "The name or glob of a file that marks the root of a repo, as per the search command",
+		},
+		cli.StringFlag{
+			Name:  "matcher",
+			Usage: "The matcher used to find references to dependencies, as per the search command",
+			Value: "word",
+		},
+		cli.StringSliceFlag{
+			Name:  "matcher-for",
+			Usage: "A glob and the matcher to use for files that match it, as per the search command",
+		},
+		cli.BoolFlag{
+			Name:  "file-names-only",
+			Usage: "Searches for the names of the files found at the previous level, as per the search command",
+		},
+		cli.StringSliceFlag{
+			Name:  "stop-name",
+			Usage: "A file name or glob that should not become a dependency, as per the search command",
+		},
+		cli.BoolFlag{
+			Name:  "no-default-stop-names",
+			Usage: "Leaves out the built-in stop list, as per the search command",
+		},
+		cli.IntFlag{
+			Name:  "min-name-length",
+			Usage: "The minimum length of a file name that can become a dependency, as per the search command",
+			Value: 3,
+		},
+		cli.Float64Flag{
+			Name:  "min-name-entropy",
+			Usage: "The entropy that a file name must exceed to become a dependency, as per the search command",
+			Value: 1,
+		},
+		cli.IntFlag{
+			Name:  "workers",
+			Usage: "The number of files to search in parallel. Defaults to the number of CPUs",
+			Value: runtime.NumCPU(),
+		},
+		cli.BoolFlag{
+			Name:  "archives",
+			Usage: "Searches the entries of archives as if they were files in the repo, as per the search command",
+		},
+		cli.IntFlag{
+			Name:  "cache-mb",
+			Usage: "The number of megabytes of file contents to hold in memory between levels, as per the search command",
+			Value: 256,
+		},
+	}
+}
@@ -0,0 +1,169 @@
+// Package sarif renders the references found by a search, and the violations of the rules
+// checked against it, as SARIF 2.1.0 logs, which code scanning and review tools can show
+// alongside the code responsible.
+package sarif
+
+import (
+	"strings"
+
+	"github.com/andykuszyk/depgrok/search"
+)
+
+const (
+	Version = "2.1.0"
+	Schema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// Represents a SARIF log, holding a single run of depgrok.
+type Log struct {
+	Version string `json:"version"`
+	Schema  string `json:"$schema"`
+	Runs    []Run  `json:"runs"`
+}
+
+// Represents a run of depgrok within a Log, along with the results it found. The columns
+// of the results are counted in Unicode code points, as given by ColumnKind.
+type Run struct {
+	Tool       Tool     `json:"tool"`
+	ColumnKind string   `json:"columnKind"`
+	Results    []Result `json:"results"`
+}
+
+// Represents the tool that produced a Run, along with the rules its results are for.
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+// Represents depgrok as the driver of a Tool.
+type Driver struct {
+	Name           string `json:"name"`
+	InformationURI string `json:"informationUri"`
+	Rules          []Rule `json:"rules"`
+}
+
+// Represents a rule within a Driver: a dependency that is referenced, or a rule checked by
+// the check command.
+type Rule struct {
+	ID               string  `json:"id"`
+	ShortDescription Message `json:"shortDescription"`
+}
+
+// Represents a piece of text within a Log.
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Represents a result within a Run: a reference to a dependency, or a violation of a rule.
+type Result struct {
+	RuleID    string     `json:"ruleId"`
+	Level     string     `json:"level"`
+	Message   Message    `json:"message"`
+	Locations []Location `json:"locations"`
+}
+
+// Represents the location of a Result.
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+// Represents the file, and the region within it, of a Location.
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           *Region          `json:"region,omitempty"`
+}
+
+// Represents the file of a PhysicalLocation, by its path within its repo (the URI) and the
+// repo itself (the URIBaseID), so that results can be matched up with the files of each
+// repo wherever it is cloned.
+type ArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// Represents the line and column at which a reference starts, both counted from 1, with
+// the column counted in characters.
+type Region struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+// Returns a Log with a result for each reference of the Report, at the level of a note, and
+// a rule for each dependency. Rules are identified by the IDs of the dependencies, which
+// are their names for seeds, and qualified by their repos and paths for intermediate
+// dependencies (e.g. repo1:db/Orders.sql:Orders), so that dependencies of the same name
+// within a repo are kept apart. They are described by the names shown in diagrams, e.g.
+// repo1:Orders.
+func FromReport(report search.Report) Log {
+	rules := []Rule{}
+	names := map[string]string{}
+	for _, dep := range report.Dependencies {
+		name := dep.Name
+		if dep.Repo != "" {
+			name = dep.Repo + ":" + dep.Name
+		}
+		names[dep.ID] = name
+		rules = append(rules, Rule{ID: dep.ID, ShortDescription: Message{Text: "References to " + name}})
+	}
+	results := []Result{}
+	for _, reference := range report.References {
+		results = append(results, Result{
+			RuleID:    reference.Dependency,
+			Level:     "note",
+			Message:   Message{Text: "This references " + names[reference.Dependency]},
+			Locations: []Location{locationOf(reference)},
+		})
+	}
+	return newLog(rules, results)
+}
+
+// Returns a Log with a result for each of the violations, at the level of an error, and a
+// rule for each of the rules that were violated, identified by its name.
+func FromViolations(violations []search.Violation) Log {
+	rules := []Rule{}
+	seen := map[string]bool{}
+	results := []Result{}
+	for _, violation := range violations {
+		if !seen[violation.Rule] {
+			seen[violation.Rule] = true
+			rules = append(rules, Rule{ID: violation.Rule, ShortDescription: Message{Text: violation.Rule}})
+		}
+		results = append(results, Result{
+			RuleID:    violation.Rule,
+			Level:     "error",
+			Message:   Message{Text: violation.Reason},
+			Locations: []Location{locationOf(violation.Reference)},
+		})
+	}
+	return newLog(rules, results)
+}
+
+func newLog(rules []Rule, results []Result) Log {
+	return Log{
+		Version: Version,
+		Schema:  Schema,
+		Runs: []Run{{
+			Tool: Tool{Driver: Driver{
+				Name:           "depgrok",
+				InformationURI: "https://github.com/andykuszyk/depgrok",
+				Rules:          rules,
+			}},
+			ColumnKind: "unicodeCodePoints",
+			Results:    results,
+		}},
+	}
+}
+
+// Returns the Location of the reference. References found within archives are located at
+// the archive itself, which is the only file a viewer can open, and without a region, as
+// their lines are those of the entry rather than of the archive.
+func locationOf(reference search.ReportReference) Location {
+	if i := strings.Index(reference.Path, search.ArchiveSeparator); i >= 0 {
+		return Location{PhysicalLocation: PhysicalLocation{
+			ArtifactLocation: ArtifactLocation{URI: reference.Path[:i], URIBaseID: reference.Repo},
+		}}
+	}
+	return Location{PhysicalLocation: PhysicalLocation{
+		ArtifactLocation: ArtifactLocation{URI: reference.Path, URIBaseID: reference.Repo},
+		Region:           &Region{StartLine: reference.Line, StartColumn: reference.Column},
+	}}
+}
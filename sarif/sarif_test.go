@@ -0,0 +1,100 @@
+package sarif
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/andykuszyk/depgrok/search"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromReport_ShouldHaveAResultForEachReference(t *testing.T) {
+	result := search.NewResult([]string{"orders"})
+	dep := result.Dependencies.Slice()[0]
+	result.Record(dep, "repo1", "repo1/db/Checkout.cs", 3, 7)
+
+	log := FromReport(result.Report())
+
+	assert.Equal(t, "2.1.0", log.Version)
+	assert.Equal(t, []Rule{
+		{ID: "orders", ShortDescription: Message{Text: "References to orders"}},
+		{ID: "repo1:db/Checkout.cs:Checkout", ShortDescription: Message{Text: "References to repo1:Checkout"}},
+	}, log.Runs[0].Tool.Driver.Rules)
+	assert.Equal(t, []Result{{
+		RuleID:  "orders",
+		Level:   "note",
+		Message: Message{Text: "This references orders"},
+		Locations: []Location{{PhysicalLocation: PhysicalLocation{
+			ArtifactLocation: ArtifactLocation{URI: "db/Checkout.cs", URIBaseID: "repo1"},
+			Region:           &Region{StartLine: 3, StartColumn: 7},
+		}}},
+	}}, log.Runs[0].Results)
+}
+
+func TestFromReport_ShouldHaveARuleForEachDependencyOfTheSameName(t *testing.T) {
+	result := search.NewResult([]string{"orders"})
+	dep := result.Dependencies.Slice()[0]
+	result.Record(dep, "repo1", "repo1/db/Checkout.cs", 3, 7)
+	result.Record(dep, "repo1", "repo1/web/Checkout.js", 1, 2)
+	for _, checkout := range result.Dependencies.Named("Checkout") {
+		result.Record(checkout, "repo2", "repo2/app.cs", 5, 1)
+	}
+
+	log := FromReport(result.Report())
+
+	ids := []string{}
+	for _, rule := range log.Runs[0].Tool.Driver.Rules {
+		ids = append(ids, rule.ID)
+	}
+	assert.Equal(t, []string{"orders", "repo1:db/Checkout.cs:Checkout", "repo1:web/Checkout.js:Checkout"}, ids)
+	ruleIDs := []string{}
+	for _, result := range log.Runs[0].Results {
+		ruleIDs = append(ruleIDs, result.RuleID)
+	}
+	assert.ElementsMatch(t, []string{"orders", "orders", "repo1:db/Checkout.cs:Checkout", "repo1:web/Checkout.js:Checkout"}, ruleIDs)
+}
+
+func TestFromReport_ShouldLocateFilesByTheirPathsWithinTheirRepos(t *testing.T) {
+	result := search.NewResult([]string{"orders"})
+	dep := result.Dependencies.Slice()[0]
+	result.RecordReference(search.Reference{Dependency: dep, Repo: "api", Path: "/ws/api/src/api/h.go", File: "src/api/h.go", Line: 1, Column: 1}, nil)
+
+	log := FromReport(result.Report())
+
+	assert.Equal(t, ArtifactLocation{URI: "src/api/h.go", URIBaseID: "api"}, log.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation)
+}
+
+func TestFromReport_ShouldLocateEntriesOfArchivesAtTheArchive(t *testing.T) {
+	result := search.NewResult([]string{"orders"})
+	dep := result.Dependencies.Slice()[0]
+	result.Record(dep, "repo1", "repo1/lib/orders.nupkg!/content/schema.sql", 4, 2)
+
+	log := FromReport(result.Report())
+
+	assert.Equal(t, PhysicalLocation{
+		ArtifactLocation: ArtifactLocation{URI: "lib/orders.nupkg", URIBaseID: "repo1"},
+	}, log.Runs[0].Results[0].Locations[0].PhysicalLocation)
+}
+
+func TestFromViolations_ShouldHaveARuleForEachRuleViolated(t *testing.T) {
+	reference := search.ReportReference{Dependency: "orders", Repo: "repo1", Path: "repo1/a.sql", Line: 1, Column: 2}
+	violations := []search.Violation{
+		{Rule: "no orders", Reason: "repo1 must not reference orders", Reference: reference},
+		{Rule: "no orders", Reason: "repo1 must not reference orders", Reference: reference},
+	}
+
+	log := FromViolations(violations)
+
+	assert.Len(t, log.Runs[0].Tool.Driver.Rules, 1)
+	assert.Len(t, log.Runs[0].Results, 2)
+	assert.Equal(t, "error", log.Runs[0].Results[0].Level)
+}
+
+func TestLog_ShouldBeWrittenWithTheSchema(t *testing.T) {
+	contents, err := json.Marshal(FromViolations(nil))
+
+	assert.Nil(t, err)
+	assert.Contains(t, string(contents), `"$schema":"https://json.schemastore.org/sarif-2.1.0.json"`)
+	assert.Contains(t, string(contents), `"results":[]`)
+	assert.Contains(t, string(contents), `"columnKind":"unicodeCodePoints"`)
+}
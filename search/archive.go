@@ -0,0 +1,275 @@
+package search
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+)
+
+// The extensions of the archives that can be searched, which are either zip archives or
+// gzipped tar archives.
+var zipExtensions = []string{".zip", ".jar", ".war", ".ear", ".nupkg"}
+var tarExtensions = []string{".tar.gz", ".tgz"}
+
+// The separator between the path of an archive and the path of an entry within it, e.g.
+// repo1/orders.nupkg!/content/orders.sql.
+const ArchiveSeparator = "!/"
+
+// Returns true if the file at name has the extension of one of the given kinds of archive.
+func hasExtension(name string, extensions []string) bool {
+	lower := strings.ToLower(name)
+	for _, extension := range extensions {
+		if strings.HasSuffix(lower, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the file at name is an archive that can be searched, judging by its
+// extension.
+func isArchive(name string) bool {
+	return hasExtension(name, zipExtensions) || hasExtension(name, tarExtensions)
+}
+
+// Represents a regular file within an archive.
+type archiveEntry struct {
+	Name string
+	Info fs.FileInfo
+}
+
+// Reads the archive at name within fsys, returning its regular file entries, along with a
+// file system from which their contents can be read, and the number of bytes that file
+// system holds in memory.
+func readArchive(fsys fs.FS, name string) ([]archiveEntry, fs.FS, int64, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if hasExtension(name, zipExtensions) {
+		return readZip(data)
+	}
+	return readTar(data)
+}
+
+// Reads a zip archive, whose entries are decompressed as they are read, so only the
+// archive itself is held in memory.
+func readZip(data []byte) ([]archiveEntry, fs.FS, int64, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	entries := []archiveEntry{}
+	for _, file := range reader.File {
+		info := file.FileInfo()
+		if info.Mode().IsRegular() && fs.ValidPath(file.Name) {
+			entries = append(entries, archiveEntry{Name: file.Name, Info: info})
+		}
+	}
+	return entries, reader, int64(len(data)), nil
+}
+
+// Reads a gzipped tar archive, whose entries are decompressed up front and held in memory.
+func readTar(data []byte) ([]archiveEntry, fs.FS, int64, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer gzipReader.Close()
+	reader := tar.NewReader(gzipReader)
+	entries := []archiveEntry{}
+	contents := tarFS{}
+	size := int64(0)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return entries, contents, size, nil
+		}
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		name := strings.TrimPrefix(path.Clean(header.Name), "./")
+		if header.Typeflag != tar.TypeReg || !fs.ValidPath(name) {
+			continue
+		}
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		entry := archiveEntry{Name: name, Info: header.FileInfo()}
+		entries = append(entries, entry)
+		contents[name] = &tarEntry{archiveEntry: entry, data: data}
+		size += int64(len(data))
+	}
+}
+
+// Represents an archive whose entries are searched, as a file system from which they can be
+// read. If the archive fits within the cache's budget, it is held in memory for the rest of
+// the search. Otherwise, it is released once each level has searched all of its entries,
+// and read again when the next level opens one of them.
+type archiveFS struct {
+	parent fs.FS
+	name   string
+	held   bool
+
+	mutex   sync.Mutex
+	opened  fs.FS
+	pending int
+}
+
+// Reads the archive at name within parent, returning its regular file entries, along with
+// the archive, which is held in memory for the rest of the search if it fits within the
+// cache's budget.
+func openArchive(parent fs.FS, name string, cache *fileCache) ([]archiveEntry, *archiveFS, error) {
+	entries, opened, size, err := readArchive(parent, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, &archiveFS{parent: parent, name: name, held: cache.reserve(size), opened: opened}, nil
+}
+
+// Opens the entry of the given name for reading, reading the archive again if it has been
+// released.
+func (a *archiveFS) Open(name string) (fs.File, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.opened == nil {
+		// An archive nested within another is read from its parent, which must not be
+		// released whilst it is.
+		acquireEntry(a.parent)
+		defer releaseEntry(a.parent)
+		_, opened, _, err := readArchive(a.parent, a.name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		a.opened = opened
+	}
+	return a.opened.Open(name)
+}
+
+// Records that an entry of the archive is waiting to be searched, so that the archive is
+// not released until it has been.
+func (a *archiveFS) acquire() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.pending++
+}
+
+// Records that an entry of the archive has been searched, releasing the archive if it does
+// not fit within the cache's budget, and none of its other entries are waiting to be
+// searched.
+func (a *archiveFS) release() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.pending--
+	if a.pending == 0 && !a.held {
+		a.opened = nil
+	}
+}
+
+// Acquires the archive holding the file at fsys, if it is an entry of an archive.
+func acquireEntry(fsys fs.FS) {
+	if archive, ok := fsys.(*archiveFS); ok {
+		archive.acquire()
+	}
+}
+
+// Releases the archive holding the file at fsys, if it is an entry of an archive.
+func releaseEntry(fsys fs.FS) {
+	if archive, ok := fsys.(*archiveFS); ok {
+		archive.release()
+	}
+}
+
+// Holds the contents of the regular files within a tar archive, which can only be read
+// sequentially, as a file system.
+type tarFS map[string]*tarEntry
+
+type tarEntry struct {
+	archiveEntry
+	data []byte
+}
+
+// Opens the entry of the given name for reading.
+func (t tarFS) Open(name string) (fs.File, error) {
+	entry, ok := t[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &tarFile{info: entry.Info, Reader: bytes.NewReader(entry.data)}, nil
+}
+
+// Represents an entry of a tar archive that has been opened for reading.
+type tarFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *tarFile) Close() error {
+	return nil
+}
+
+// Returns true if the entry of an archive at the given path should be searched, according
+// to the same rules as files found by Walk.
+func shouldSearchEntry(name string, exclude []string, include []string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if !isValidParent(part) || matchesGlob(part, exclude) {
+			return false
+		}
+	}
+	return len(include) == 0 || matchesGlob(name, include) || isArchive(name)
+}
+
+// Walks the entries of the archive at name within fsys, calling fn with a job for each of
+// them that should be searched. The path of each entry is reported as the archive's path,
+// followed by ArchiveSeparator and the entry's path within it, and entries that are
+// themselves archives are walked in turn.
+//
+// The entries are read from an archiveFS, which holds the archive in memory for the rest
+// of the search if it fits within the cache's budget, or else for as long as its entries
+// are being searched at each level, so that the archive is read (and decompressed) at
+// most once per level rather than once per entry.
+//
+// If the archive cannot be read, e.g. because it is not really an archive, a job for the
+// archive itself is passed to fn instead (subject to the include globs), so that it is
+// searched like any other file.
+func (s *Searcher) walkArchive(repo string, archivePath string, archiveFile string, fsys fs.FS, name string, info fs.FileInfo, cache *fileCache, fn func(job searchJob) error) error {
+	entries, opened, err := openArchive(fsys, name, cache)
+	if err != nil {
+		if len(s.options.Include) > 0 && !matchesGlob(name, s.options.Include) {
+			return nil
+		}
+		return fn(searchJob{Repo: repo, Path: archivePath, File: archiveFile, FS: fsys, Name: name, Info: info})
+	}
+	// The archive is acquired whilst it is walked, so that it is not released as soon as
+	// the first of its entries has been searched.
+	opened.acquire()
+	defer opened.release()
+	for _, entry := range entries {
+		if !shouldSearchEntry(entry.Name, s.options.Exclude, s.options.Include) {
+			continue
+		}
+		entryPath := archivePath + ArchiveSeparator + entry.Name
+		entryFile := archiveFile + ArchiveSeparator + entry.Name
+		if isArchive(entry.Name) {
+			err = s.walkArchive(repo, entryPath, entryFile, opened, entry.Name, entry.Info, cache, fn)
+		} else {
+			err = fn(searchJob{Repo: repo, Path: entryPath, File: entryFile, FS: opened, Name: entry.Name, Info: entry.Info})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package search
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Builds a zip archive of the given files.
+func buildZip(t *testing.T, files map[string]string) []byte {
+	buffer := bytes.Buffer{}
+	writer := zip.NewWriter(&buffer)
+	for name, contents := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("Unexpected error creating %s: %v", name, err)
+		}
+		file.Write([]byte(contents))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Unexpected error writing zip: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// Builds a gzipped tar archive of the given files.
+func buildTarGz(t *testing.T, files map[string]string) []byte {
+	buffer := bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(gzipWriter)
+	for name, contents := range files {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatalf("Unexpected error writing header for %s: %v", name, err)
+		}
+		writer.Write([]byte(contents))
+	}
+	writer.Close()
+	gzipWriter.Close()
+	return buffer.Bytes()
+}
+
+func searchArchives(t *testing.T, tree fstest.MapFS, options Options) []string {
+	options.FS = []fs.FS{tree}
+	options.Seeds = []string{"orders"}
+	options.Depth = 1
+	options.Archives = true
+	searcher, err := NewSearcher(options)
+	if err != nil {
+		t.Fatalf("Unexpected error creating the searcher: %v", err)
+	}
+	result, err := searcher.Search()
+	if err != nil {
+		t.Fatalf("Unexpected error searching: %v", err)
+	}
+	paths := []string{}
+	for _, reference := range result.References {
+		paths = append(paths, reference.Path)
+	}
+	return paths
+}
+
+func TestSearcherSearch_ShouldSearchEntriesOfArchives(t *testing.T) {
+	jar := buildZip(t, map[string]string{"sql/query.sql": " select * from orders\n"})
+	tree := fstest.MapFS{
+		"repo1/Orders.nupkg": {Data: buildZip(t, map[string]string{
+			"content/orders.sql":     " create table orders\n",
+			"content/report.sql":     " select * from orders\n",
+			"lib/Orders.Queries.jar": string(jar),
+			"content/.hidden/a.sql":  " select * from orders\n",
+		})},
+		"repo2/schema.tar.gz": {Data: buildTarGz(t, map[string]string{"./db/view.sql": " select * from orders\n"})},
+	}
+
+	paths := searchArchives(t, tree, Options{})
+
+	assert.ElementsMatch(t, []string{
+		"repo1/Orders.nupkg!/content/report.sql",
+		"repo1/Orders.nupkg!/lib/Orders.Queries.jar!/sql/query.sql",
+		"repo2/schema.tar.gz!/db/view.sql",
+	}, paths)
+}
+
+func TestSearcherSearch_ShouldApplyGlobsToEntriesOfArchives(t *testing.T) {
+	tree := fstest.MapFS{
+		"repo1/Orders.nupkg": {Data: buildZip(t, map[string]string{
+			"content/report.sql": " select * from orders\n",
+			"content/report.md":  " select * from orders\n",
+		})},
+		"repo1/query.sql": {Data: []byte(" select * from orders\n")},
+		"repo1/query.cs":  {Data: []byte(" select * from orders\n")},
+	}
+
+	paths := searchArchives(t, tree, Options{Include: []string{"*.sql"}})
+
+	assert.ElementsMatch(t, []string{"repo1/Orders.nupkg!/content/report.sql", "repo1/query.sql"}, paths)
+}
+
+func TestSearcherSearch_ShouldSearchInvalidArchivesAsFiles(t *testing.T) {
+	tree := fstest.MapFS{
+		"repo1/notreally.zip": {Data: []byte(" select * from orders\n")},
+	}
+
+	paths := searchArchives(t, tree, Options{})
+
+	assert.Equal(t, []string{"repo1/notreally.zip"}, paths)
+}
+
+func TestSearcherSearch_ShouldRereadEntriesOfArchivesBeyondFirstLevel(t *testing.T) {
+	tree := fstest.MapFS{
+		"repo1/Orders.nupkg": {Data: buildZip(t, map[string]string{
+			"content/report.sql":  " select * from orders\n",
+			"content/summary.sql": " exec report\n",
+		})},
+	}
+	searcher, _ := NewSearcher(Options{FS: []fs.FS{tree}, Seeds: []string{"orders"}, Depth: 2, Archives: true})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(result.References))
+	assert.Equal(t, "repo1/Orders.nupkg!/content/summary.sql", result.References[1].Path)
+}
+
+// Counts the number of times each file is opened from the file system it wraps.
+type countingFS struct {
+	fs.FS
+	opens map[string]int
+	mutex sync.Mutex
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	c.mutex.Lock()
+	c.opens[name]++
+	c.mutex.Unlock()
+	return c.FS.Open(name)
+}
+
+func TestSearcherSearch_ShouldReadEachArchiveOnce(t *testing.T) {
+	tree := &countingFS{opens: map[string]int{}, FS: fstest.MapFS{
+		"repo1/Orders.nupkg": {Data: buildZip(t, map[string]string{
+			"content/report.sql":  " select * from orders\n",
+			"content/summary.sql": " exec report\n",
+			"content/other.sql":   " select 1\n",
+		})},
+		"repo2/schema.tar.gz": {Data: buildTarGz(t, map[string]string{"db/view.sql": " exec report\n"})},
+	}}
+	searcher, _ := NewSearcher(Options{FS: []fs.FS{tree}, Seeds: []string{"orders"}, Depth: 2, Archives: true})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(result.References))
+	assert.Equal(t, 1, tree.opens["repo1/Orders.nupkg"])
+	assert.Equal(t, 1, tree.opens["repo2/schema.tar.gz"])
+}
+
+func TestSearcherSearch_ShouldReadArchivesBeyondTheBudgetOncePerLevel(t *testing.T) {
+	tree := &countingFS{opens: map[string]int{}, FS: fstest.MapFS{
+		"repo1/Orders.nupkg": {Data: buildZip(t, map[string]string{
+			"content/report.sql":  " select * from orders\n",
+			"content/summary.sql": " exec report\n",
+			"content/other.sql":   " select 1\n",
+		})},
+		"repo2/schema.tar.gz": {Data: buildTarGz(t, map[string]string{"db/view.sql": " exec report\n"})},
+		"repo3/nested.zip": {Data: buildZip(t, map[string]string{
+			"lib/inner.jar": string(buildZip(t, map[string]string{"inner.sql": " exec summary\n"})),
+		})},
+	}}
+	searcher, _ := NewSearcher(Options{FS: []fs.FS{tree}, Seeds: []string{"orders"}, Depth: 3, Archives: true, CacheBudget: NoCache})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(result.References))
+	assert.Equal(t, 3, tree.opens["repo1/Orders.nupkg"])
+	assert.Equal(t, 3, tree.opens["repo2/schema.tar.gz"])
+	assert.Equal(t, 3, tree.opens["repo3/nested.zip"])
+}
+
+func TestOpenArchive_ShouldOnlyHoldArchivesWithinTheBudget(t *testing.T) {
+	tree := fstest.MapFS{"schema.tar.gz": {Data: buildTarGz(t, map[string]string{"a.sql": "0123456789", "b.sql": "0123456789"})}}
+
+	for budget, held := range map[int64]bool{19: false, 20: true} {
+		cache := newFileCache(budget)
+
+		_, archive, err := openArchive(tree, "schema.tar.gz", cache)
+
+		assert.Nil(t, err)
+		assert.Equal(t, held, archive.held, "budget %d", budget)
+		archive.acquire()
+		archive.release()
+		assert.Equal(t, held, archive.opened != nil, "budget %d", budget)
+	}
+}
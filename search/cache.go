@@ -0,0 +1,105 @@
+package search
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"sync"
+)
+
+// Represents a file found whilst walking the directory tree, along with its contents if
+// they fitted within the cache's memory budget.
+type cachedFile struct {
+	Repo     string
+	Path     string
+	File     string
+	fsys     fs.FS
+	name     string
+	contents []byte
+}
+
+// Opens the file for reading, from memory if its contents are cached or from its file
+// system if not.
+func (f *cachedFile) open() (io.ReadCloser, error) {
+	if f.contents != nil {
+		return ioutil.NopCloser(bytes.NewReader(f.contents)), nil
+	}
+	return f.fsys.Open(f.name)
+}
+
+// Reads the contents of the file, from memory if they are cached or else from its file
+// system, unless they are not cached and are longer than limit bytes, in which case false
+// is returned, having read no more than is needed to tell.
+func (f *cachedFile) read(limit int64) ([]byte, bool, error) {
+	if f.contents != nil {
+		return f.contents, true, nil
+	}
+	reader, err := f.open()
+	if err != nil {
+		return nil, false, err
+	}
+	defer reader.Close()
+	contents, err := ioutil.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil || int64(len(contents)) > limit {
+		return nil, false, err
+	}
+	return contents, true, nil
+}
+
+// Records the files searched on the first pass of the directory tree, so that deeper
+// levels can be resolved without walking the tree again. File contents (and archives) are
+// held in memory until the budget (in bytes) is used up, after which files are re-read
+// from disk when they are needed.
+type fileCache struct {
+	files  []*cachedFile
+	budget int64
+	used   int64
+	mutex  sync.Mutex
+}
+
+// Constructs a new fileCache, which will hold up to budget bytes of file contents.
+func newFileCache(budget int64) *fileCache {
+	return &fileCache{budget: budget}
+}
+
+// Reserves size bytes of the budget, returning false if there is not room for them.
+func (c *fileCache) reserve(size int64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.used+size > c.budget {
+		return false
+	}
+	c.used += size
+	return true
+}
+
+// Adds the file found by the given job to the cache, reading its contents into memory if
+// there is room for them within the budget. The entries of archives are not copied, since
+// they are read from their archive, which has a share of the budget in its own right.
+func (c *fileCache) add(job searchJob) (*cachedFile, error) {
+	file := &cachedFile{Repo: job.Repo, Path: job.Path, File: job.File, fsys: job.FS, name: job.Name}
+	if _, ok := job.FS.(*archiveFS); !ok && c.reserve(job.Info.Size()) {
+		contents, err := fs.ReadFile(job.FS, job.Name)
+		if err != nil {
+			return nil, err
+		}
+		file.contents = contents
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.files = append(c.files, file)
+	return file, nil
+}
+
+// Returns a slice of the files held in the cache.
+func (c *fileCache) Slice() []*cachedFile {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	s := []*cachedFile{}
+	for _, file := range c.files {
+		s = append(s, file)
+	}
+	return s
+}
@@ -0,0 +1,98 @@
+package search
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func addToCache(t *testing.T, cache *fileCache, repo string, path string) *cachedFile {
+	tree := testTree()
+	info, err := fs.Stat(tree, path)
+	if err != nil {
+		t.Fatalf("Unexpected error calling fs.Stat(%s): %v", path, err)
+	}
+	file, err := cache.add(searchJob{Repo: repo, Path: path, File: strings.TrimPrefix(path, repo+"/"), FS: tree, Name: path, Info: info})
+	if err != nil {
+		t.Fatalf("Unexpected error adding %s to the cache: %v", path, err)
+	}
+	return file
+}
+
+func TestFileCacheAdd_ShouldOnlyHoldContentsWithinBudget(t *testing.T) {
+	// file.lang is 17 bytes, and thing.lang is 28 bytes.
+	cache := newFileCache(20)
+
+	first := addToCache(t, cache, "repo1", "repo1/file.lang")
+	second := addToCache(t, cache, "repo4", "repo4/thing.lang")
+
+	if first.contents == nil {
+		t.Error("The first file should have been held in memory")
+	}
+	if second.contents != nil {
+		t.Error("The second file should not have been held in memory, as it exceeds the budget")
+	}
+	if len(cache.Slice()) != 2 {
+		t.Errorf("Expected there to be 2 files in the cache, but there were %d", len(cache.Slice()))
+	}
+}
+
+func TestSearcherSearchCache_ShouldFindDependenciesWithAndWithoutContents(t *testing.T) {
+	for _, budget := range []int64{0, 1024} {
+		cache := newFileCache(budget)
+		addToCache(t, cache, "repo1", "repo1/file.lang")
+		addToCache(t, cache, "repo4", "repo4/thing.lang")
+		searcher, _ := NewSearcher(Options{Roots: []string{"unused"}, Seeds: []string{"dependency1"}, Depth: 1, Workers: 2})
+		result := NewResult([]string{"dependency1"})
+		dependencies := result.Dependencies
+		matchers, _ := searcher.buildMatchers(dependencies.Slice())
+
+		err := searcher.searchCache(result, matchers, 0, cache)
+
+		if err != nil {
+			t.Fatalf("Unexpected error searching the cache: %v", err)
+		}
+		dependency := dependencies.Slice()[0]
+		if len(dependency.Repos) != 1 || !dependency.Repos["repo1"] {
+			t.Errorf("Expected dependency1 to be found in repo1 only with budget %d, but found %v", budget, dependency.Repos)
+		}
+		if len(dependencies.Named("file")) == 0 {
+			t.Errorf("Expected file to have been added as a dependency with budget %d", budget)
+		}
+	}
+}
+
+func TestFileCacheAdd_ShouldNotCopyEntriesOfArchives(t *testing.T) {
+	cache := newFileCache(1024)
+	archive := &archiveFS{opened: testTree()}
+	info, _ := fs.Stat(testTree(), "repo1/file.lang")
+
+	file, err := cache.add(searchJob{Repo: "repo1", Path: "repo1.zip!/repo1/file.lang", FS: archive, Name: "repo1/file.lang", Info: info})
+
+	if err != nil {
+		t.Fatalf("Unexpected error adding an entry of an archive to the cache: %v", err)
+	}
+	if file.contents != nil || cache.used != 0 {
+		t.Errorf("Expected the entry to be read from its archive, but %d bytes were copied", cache.used)
+	}
+}
+
+func TestCachedFileRead_ShouldNotReadFilesLongerThanTheLimitUnlessCached(t *testing.T) {
+	// file.lang is 17 bytes.
+	for budget, expected := range map[int64]bool{0: false, 1024: true} {
+		file := addToCache(t, newFileCache(budget), "repo1", "repo1/file.lang")
+
+		contents, ok, err := file.read(16)
+
+		if err != nil {
+			t.Fatalf("Unexpected error reading the file: %v", err)
+		}
+		if ok != expected || (len(contents) == 17) != expected {
+			t.Errorf("Expected the file to be read (%v) with budget %d, but got %v and %q", expected, budget, ok, contents)
+		}
+	}
+	file := addToCache(t, newFileCache(0), "repo1", "repo1/file.lang")
+	if contents, ok, _ := file.read(17); !ok || len(contents) != 17 {
+		t.Errorf("Expected a file as long as the limit to be read, but got %v and %q", ok, contents)
+	}
+}
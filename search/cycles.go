@@ -0,0 +1,133 @@
+package search
+
+import (
+	"sort"
+
+	"github.com/andykuszyk/depgrok/deps"
+)
+
+// Returns the cycles amongst the dependencies found, i.e. the chains of dependencies that
+// reference each other in a loop, such as A -> B -> A, where a file defining A references
+// B, and a file defining B references A. Each cycle starts and ends with the same
+// dependency, which is the one with the lowest Key, and is the shortest loop through it
+// within its group of mutually dependent dependencies. Cycles are sorted by their first
+// dependency.
+func (r *Result) Cycles() [][]*deps.Dependency {
+	r.mutex.Lock()
+	edges := map[*deps.Dependency][]*deps.Dependency{}
+	nodes := []*deps.Dependency{}
+	for from, tos := range r.edges {
+		nodes = append(nodes, from)
+		for to := range tos {
+			edges[from] = append(edges[from], to)
+		}
+		sortByKey(edges[from])
+	}
+	r.mutex.Unlock()
+	sortByKey(nodes)
+
+	cycles := [][]*deps.Dependency{}
+	for _, component := range stronglyConnected(nodes, edges) {
+		if len(component) < 2 {
+			continue
+		}
+		sortByKey(component)
+		cycles = append(cycles, shortestCycle(component, edges))
+	}
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0].Key() < cycles[j][0].Key()
+	})
+	return cycles
+}
+
+func sortByKey(dependencies []*deps.Dependency) {
+	sort.Slice(dependencies, func(i, j int) bool {
+		return dependencies[i].Key() < dependencies[j].Key()
+	})
+}
+
+// Returns the strongly connected components of the graph, using Tarjan's algorithm. Each
+// component is a group of dependencies that can all be reached from each other.
+func stronglyConnected(nodes []*deps.Dependency, edges map[*deps.Dependency][]*deps.Dependency) [][]*deps.Dependency {
+	index := map[*deps.Dependency]int{}
+	lowLink := map[*deps.Dependency]int{}
+	onStack := map[*deps.Dependency]bool{}
+	stack := []*deps.Dependency{}
+	components := [][]*deps.Dependency{}
+
+	var visit func(node *deps.Dependency)
+	visit = func(node *deps.Dependency) {
+		index[node] = len(index)
+		lowLink[node] = index[node]
+		stack = append(stack, node)
+		onStack[node] = true
+		for _, next := range edges[node] {
+			if _, visited := index[next]; !visited {
+				visit(next)
+				if lowLink[next] < lowLink[node] {
+					lowLink[node] = lowLink[next]
+				}
+			} else if onStack[next] && index[next] < lowLink[node] {
+				lowLink[node] = index[next]
+			}
+		}
+		if lowLink[node] != index[node] {
+			return
+		}
+		component := []*deps.Dependency{}
+		for {
+			last := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[last] = false
+			component = append(component, last)
+			if last == node {
+				break
+			}
+		}
+		components = append(components, component)
+	}
+	for _, node := range nodes {
+		if _, visited := index[node]; !visited {
+			visit(node)
+		}
+	}
+	return components
+}
+
+// Returns the shortest loop from the first dependency of the component back to itself,
+// found by a breadth first search of the edges within the component.
+func shortestCycle(component []*deps.Dependency, edges map[*deps.Dependency][]*deps.Dependency) []*deps.Dependency {
+	start := component[0]
+	within := map[*deps.Dependency]bool{}
+	for _, node := range component {
+		within[node] = true
+	}
+	previous := map[*deps.Dependency]*deps.Dependency{}
+	queue := []*deps.Dependency{start}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[node] {
+			if !within[next] {
+				continue
+			}
+			if next == start {
+				cycle := []*deps.Dependency{start}
+				for ; node != start; node = previous[node] {
+					cycle = append(cycle, node)
+				}
+				cycle = append(cycle, start)
+				// The loop was collected backwards, from its end to its start.
+				for i, j := 0, len(cycle)-1; i < j; i, j = i+1, j-1 {
+					cycle[i], cycle[j] = cycle[j], cycle[i]
+				}
+				return cycle
+			}
+			if _, seen := previous[next]; !seen {
+				previous[next] = node
+				queue = append(queue, next)
+			}
+		}
+	}
+	return component
+}
@@ -0,0 +1,61 @@
+package search
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/andykuszyk/depgrok/deps"
+	"github.com/stretchr/testify/assert"
+)
+
+func displayNames(cycle []*deps.Dependency) []string {
+	names := []string{}
+	for _, dep := range cycle {
+		names = append(names, dep.DisplayName())
+	}
+	return names
+}
+
+func TestResultCycles_ShouldFindDependenciesThatReferenceEachOther(t *testing.T) {
+	tree := fstest.MapFS{
+		"repo1/a.sql": {Data: []byte("CREATE VIEW vw_A AS\nSELECT * FROM orders JOIN vw_B\n")},
+		"repo2/b.sql": {Data: []byte("CREATE VIEW vw_B AS\nSELECT * FROM vw_A\n")},
+	}
+	searcher, _ := NewSearcher(Options{FS: []fs.FS{tree}, Seeds: []string{"orders"}, Depth: 3})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	cycles := result.Cycles()
+	assert.Equal(t, 1, len(cycles))
+	assert.Equal(t, []string{"repo1:vw_A", "repo2:vw_B", "repo1:vw_A"}, displayNames(cycles[0]))
+}
+
+func TestResultCycles_ShouldReturnShortestLoopThroughFirstDependency(t *testing.T) {
+	result := NewResult([]string{"seed"})
+	a := &deps.Dependency{Name: "a", Repo: "r", Path: "a"}
+	b := &deps.Dependency{Name: "b", Repo: "r", Path: "b"}
+	c := &deps.Dependency{Name: "c", Repo: "r", Path: "c"}
+	d := &deps.Dependency{Name: "d", Repo: "r", Path: "d"}
+	result.addEdge(a, b)
+	result.addEdge(b, c)
+	result.addEdge(c, a)
+	result.addEdge(b, a)
+	result.addEdge(d, a)
+
+	cycles := result.Cycles()
+
+	assert.Equal(t, 1, len(cycles))
+	assert.Equal(t, []string{"r:a", "r:b", "r:a"}, displayNames(cycles[0]))
+}
+
+func TestResultCycles_ShouldReturnNoCyclesForTree(t *testing.T) {
+	result := NewResult([]string{"seed"})
+	seed := result.Dependencies.Slice()[0]
+	a := &deps.Dependency{Name: "a", Repo: "r", Path: "a"}
+	result.addEdge(a, seed)
+	result.addEdge(&deps.Dependency{Name: "b", Repo: "r", Path: "b"}, a)
+
+	assert.Equal(t, 0, len(result.Cycles()))
+}
@@ -0,0 +1,122 @@
+package search
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Returns the names of the entities defined in the contents of a file, such as the
+// procedures created by a SQL script, or the classes declared in a C# file.
+type Extractor func(contents []byte) []string
+
+var extractors = map[string]Extractor{
+	".sql":  extractSQL,
+	".cs":   extractClasses,
+	".java": extractClasses,
+	".go":   extractGo,
+	".py":   extractPython,
+	".js":   extractJavaScript,
+	".jsx":  extractJavaScript,
+	".mjs":  extractJavaScript,
+	".ts":   extractJavaScript,
+	".tsx":  extractJavaScript,
+}
+var extractorsMutex sync.RWMutex
+
+// Registers the Extractor used for files with the given extension, e.g. .sql, replacing
+// any Extractor already registered for it.
+func RegisterExtractor(extension string, extractor Extractor) {
+	extractorsMutex.Lock()
+	defer extractorsMutex.Unlock()
+	extractors[strings.ToLower(extension)] = extractor
+}
+
+// Returns the Extractor registered for the extension of the file at the given path, or nil
+// if there is not one.
+func ExtractorFor(name string) Extractor {
+	extractorsMutex.RLock()
+	defer extractorsMutex.RUnlock()
+	return extractors[strings.ToLower(path.Ext(name))]
+}
+
+// Returns the names captured by the first group of each of the regexps within the
+// contents, in the order in which they are first found, without duplicates.
+func extractMatches(contents []byte, regexps ...*regexp.Regexp) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, r := range regexps {
+		for _, match := range r.FindAllSubmatch(contents, -1) {
+			name := string(match[1])
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+var sqlDefinition = regexp.MustCompile(`(?i)\bcreate\s+(?:or\s+(?:replace|alter)\s+)?(?:procedure|proc|view|function|table)\s+(?:if\s+not\s+exists\s+)?((?:(?:\[[^\]]+\]|"[^"]+"|` + "`[^`]+`" + `|\w+)\s*\.\s*)*(?:\[[^\]]+\]|"[^"]+"|` + "`[^`]+`" + `|\w+))`)
+
+// Extracts the names of the procedures, views, functions and tables created by a SQL
+// script, without their schemas or quoting, e.g. usp_GetOrders for
+// CREATE PROCEDURE [dbo].[usp_GetOrders].
+func extractSQL(contents []byte) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, qualified := range extractMatches(contents, sqlDefinition) {
+		parts := strings.Split(qualified, ".")
+		name := strings.Trim(strings.TrimSpace(parts[len(parts)-1]), "[]\"`")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+var classDefinition = regexp.MustCompile(`\b(?:class|interface|struct|record(?:\s+(?:struct|class))?|enum)\s+([A-Za-z_]\w*)`)
+var cComment = regexp.MustCompile(`(?s)//[^\n]*|/\*.*?\*/`)
+
+// Extracts the names of the classes, interfaces, structs, records and enums declared in a
+// C# or Java file, including record structs and record classes, e.g. Point for
+// public record struct Point. Comments are ignored, so that prose such as "this class
+// handles orders" is not taken to declare anything.
+func extractClasses(contents []byte) []string {
+	return extractMatches(cComment.ReplaceAll(contents, nil), classDefinition)
+}
+
+var goFunc = regexp.MustCompile(`(?m)^func\s+([A-Z]\w*)`)
+var goType = regexp.MustCompile(`(?m)^type\s+([A-Z]\w*)`)
+var goTypeGroup = regexp.MustCompile(`(?ms)^type\s*\((.*?)^\)`)
+var goGroupedType = regexp.MustCompile(`(?m)^\s+([A-Z]\w*)\s`)
+
+// Extracts the names of the exported functions and types declared in a Go file, leaving
+// out methods, which are not referenced by name alone.
+func extractGo(contents []byte) []string {
+	names := extractMatches(contents, goFunc, goType)
+	for _, group := range goTypeGroup.FindAllSubmatch(contents, -1) {
+		names = append(names, extractMatches(group[1], goGroupedType)...)
+	}
+	return names
+}
+
+var pythonDefinition = regexp.MustCompile(`(?m)^(?:async\s+def|def|class)\s+([A-Za-z]\w*)`)
+
+// Extracts the names of the public functions and classes declared at the top level of a
+// Python module.
+func extractPython(contents []byte) []string {
+	return extractMatches(contents, pythonDefinition)
+}
+
+var javaScriptFunction = regexp.MustCompile(`(?m)^(?:export\s+(?:default\s+)?)?(?:async\s+)?function\s*\*?\s*([A-Za-z_$][\w$]*)`)
+var javaScriptClass = regexp.MustCompile(`(?m)^(?:export\s+(?:default\s+)?)?(?:abstract\s+)?class\s+([A-Za-z_$][\w$]*)`)
+var javaScriptArrow = regexp.MustCompile(`(?m)^(?:export\s+)?(?:const|let|var)\s+([A-Za-z_$][\w$]*)\s*=\s*(?:async\s*)?(?:function\b|\([^)]*\)\s*=>|[A-Za-z_$][\w$]*\s*=>)`)
+
+// Extracts the names of the functions and classes declared at the top level of a
+// JavaScript or TypeScript module, including functions assigned to constants.
+func extractJavaScript(contents []byte) []string {
+	return extractMatches(contents, javaScriptFunction, javaScriptClass, javaScriptArrow)
+}
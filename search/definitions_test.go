@@ -0,0 +1,124 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractSQL_ShouldReturnCreatedProceduresViewsFunctionsAndTables(t *testing.T) {
+	contents := []byte(`
+CREATE PROCEDURE [dbo].[usp_GetOrders] AS SELECT * FROM orders
+GO
+create or alter view dbo.vw_OpenOrders as select * from orders
+GO
+CREATE FUNCTION "sales"."fn_Total"() RETURNS int
+CREATE TABLE IF NOT EXISTS order_lines (id int)
+CREATE TABLE #scratch (id int)
+CREATE INDEX ix_orders ON orders (id)
+`)
+
+	names := extractSQL(contents)
+
+	assert.Equal(t, []string{"usp_GetOrders", "vw_OpenOrders", "fn_Total", "order_lines"}, names)
+}
+
+func TestExtractClasses_ShouldReturnDeclaredTypes(t *testing.T) {
+	contents := []byte(`
+namespace Orders {
+    public sealed class OrderRepository : IOrderRepository { }
+    internal interface IOrderRepository { }
+    public record OrderPlaced(int Id);
+    enum OrderStatus { Open, Closed }
+}
+`)
+
+	names := extractClasses(contents)
+
+	assert.Equal(t, []string{"OrderRepository", "IOrderRepository", "OrderPlaced", "OrderStatus"}, names)
+}
+
+func TestExtractClasses_ShouldReturnRecordStructsAndClasses(t *testing.T) {
+	contents := []byte(`
+public record struct Point(int X, int Y);
+public record class Order(int Id);
+`)
+
+	names := extractClasses(contents)
+
+	assert.Equal(t, []string{"Point", "Order"}, names)
+}
+
+func TestExtractClasses_ShouldIgnoreComments(t *testing.T) {
+	contents := []byte(`
+// this class handles orders
+/* an interface for
+   the struct below */
+public class OrderHandler { }
+`)
+
+	names := extractClasses(contents)
+
+	assert.Equal(t, []string{"OrderHandler"}, names)
+}
+
+func TestExtractGo_ShouldReturnExportedFunctionsAndTypes(t *testing.T) {
+	contents := []byte(`package orders
+
+type Repository struct{}
+
+type (
+	Order struct{}
+	status int
+	Status int
+)
+
+func NewRepository() *Repository { return nil }
+
+func (r *Repository) GetOrders() []Order { return nil }
+
+func helper() {}
+`)
+
+	names := extractGo(contents)
+
+	assert.Equal(t, []string{"NewRepository", "Repository", "Order", "Status"}, names)
+}
+
+func TestExtractPython_ShouldReturnTopLevelFunctionsAndClasses(t *testing.T) {
+	contents := []byte(`
+class OrderRepository:
+    def get_orders(self):
+        pass
+
+async def fetch_orders():
+    pass
+
+def _private():
+    pass
+`)
+
+	names := extractPython(contents)
+
+	assert.Equal(t, []string{"OrderRepository", "fetch_orders"}, names)
+}
+
+func TestExtractJavaScript_ShouldReturnTopLevelFunctionsAndClasses(t *testing.T) {
+	contents := []byte(`
+export default async function getOrders() {}
+export class OrderStore {}
+const formatOrder = (order) => order.id;
+export const fetchOrders = async id => fetch(id);
+const limit = 10;
+`)
+
+	names := extractJavaScript(contents)
+
+	assert.Equal(t, []string{"getOrders", "OrderStore", "formatOrder", "fetchOrders"}, names)
+}
+
+func TestExtractorFor_ShouldSelectExtractorByExtension(t *testing.T) {
+	assert.NotNil(t, ExtractorFor("repo1/db/Orders.SQL"))
+	assert.NotNil(t, ExtractorFor("repo1/src/app.tsx"))
+	assert.Nil(t, ExtractorFor("repo1/README.md"))
+}
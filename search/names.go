@@ -0,0 +1,67 @@
+package search
+
+import (
+	"math"
+	"path"
+	"strings"
+)
+
+// The names of files that are too common to be useful as intermediate dependencies, since
+// nearly every repo has a file of the same name, or references them by word. Names are
+// compared regardless of case, and may be globs.
+var DefaultStopList = []string{
+	"app", "application", "assemblyinfo", "base", "build", "changelog", "client", "common",
+	"config", "constants", "core", "data", "default", "dockerfile", "global", "helpers",
+	"index", "init", "__init__", "lib", "license", "main", "makefile", "model", "models",
+	"module", "package", "package-lock", "program", "readme", "server", "service",
+	"settings", "setup", "src", "startup", "test", "tests", "types", "util", "utils", "web",
+}
+
+// Decides which names are promoted to intermediate dependencies when a file is found to
+// reference a dependency. Names on the stop list, names shorter than MinLength, and names
+// whose characters are too repetitive to be distinctive (with a Shannon entropy of no more
+// than MinEntropy bits per character) are not promoted, although the reference itself is
+// still recorded.
+type NameFilter struct {
+	StopList   []string
+	MinLength  int
+	MinEntropy float64
+}
+
+// Returns the NameFilter used unless another is given, which stops the names in
+// DefaultStopList, and names of fewer than 3 characters or with an entropy of no more than
+// 1, such as aaa or abab.
+func DefaultNameFilter() NameFilter {
+	return NameFilter{StopList: DefaultStopList, MinLength: 3, MinEntropy: 1}
+}
+
+// Returns true if the name should be promoted to an intermediate dependency.
+func (f NameFilter) Allows(name string) bool {
+	if len(name) < f.MinLength {
+		return false
+	}
+	lower := strings.ToLower(name)
+	for _, stop := range f.StopList {
+		if matched, _ := path.Match(strings.ToLower(stop), lower); matched {
+			return false
+		}
+	}
+	return f.MinEntropy <= 0 || entropy(lower) > f.MinEntropy
+}
+
+// Returns the Shannon entropy of the characters of s, in bits per character, e.g. 0 for
+// "aaa", 1 for "abab" and 2.25 for "orders".
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	bits := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
@@ -0,0 +1,49 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNameFilterAllows_ShouldStopCommonNames(t *testing.T) {
+	sut := DefaultNameFilter()
+
+	for _, name := range []string{"app", "Program", "README", "index", "utils", "__init__"} {
+		assert.False(t, sut.Allows(name), name)
+	}
+	for _, name := range []string{"Orders", "usp_GetOrders", "CustomerRepository"} {
+		assert.True(t, sut.Allows(name), name)
+	}
+}
+
+func TestNameFilterAllows_ShouldStopShortAndRepetitiveNames(t *testing.T) {
+	sut := NameFilter{MinLength: 3, MinEntropy: 1.5}
+
+	assert.False(t, sut.Allows("db"))
+	assert.False(t, sut.Allows("aaaa"))
+	assert.False(t, sut.Allows("abab"))
+	assert.True(t, sut.Allows("orders"))
+}
+
+func TestNameFilterAllows_ShouldStopNamesOfTheDefaultMinimumEntropy(t *testing.T) {
+	sut := DefaultNameFilter()
+
+	assert.False(t, sut.Allows("aaa"))
+	assert.False(t, sut.Allows("abab"))
+	assert.True(t, sut.Allows("abc"))
+}
+
+func TestNameFilterAllows_ShouldMatchStopListGlobsRegardlessOfCase(t *testing.T) {
+	sut := NameFilter{StopList: []string{"*.Designer", "test_*"}}
+
+	assert.False(t, sut.Allows("Form1.designer"))
+	assert.False(t, sut.Allows("TEST_orders"))
+	assert.True(t, sut.Allows("orders_test"))
+}
+
+func TestEntropy(t *testing.T) {
+	assert.Equal(t, 0.0, entropy("aaa"))
+	assert.Equal(t, 1.0, entropy("abab"))
+	assert.InDelta(t, 2.25, entropy("orders"), 0.01)
+}
@@ -0,0 +1,194 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/andykuszyk/depgrok/deps"
+)
+
+// Represents a chain of references from a repo to a dependency, one hop at a time.
+type Path struct {
+	Repo string
+	Hops []Hop
+}
+
+// Represents a hop along a Path: the first reference to Dependency from the file at Path in
+// Repo. The file of each hop after the first is the file of the previous hop's Dependency.
+type Hop struct {
+	Dependency *deps.Dependency
+	Repo       string
+	Path       string
+	Line       int
+	Column     int
+}
+
+// Returns the dependencies along the path, e.g. for display as repo -> A -> B.
+func (p Path) Dependencies() []*deps.Dependency {
+	dependencies := []*deps.Dependency{}
+	for _, hop := range p.Hops {
+		dependencies = append(dependencies, hop.Dependency)
+	}
+	return dependencies
+}
+
+// Holds the references found by a search as a graph, in which each file is linked to the
+// dependencies it references.
+type pathGraph struct {
+	// The first reference to each dependency from each file, keyed by the repo and path of
+	// the file.
+	hops map[fileKey][]Hop
+	// The files in each repo that reference any dependency.
+	files map[string][]fileKey
+}
+
+type fileKey struct {
+	Repo string
+	Path string
+}
+
+func (r *Result) pathGraph() *pathGraph {
+	r.mutex.Lock()
+	references := append([]Reference{}, r.References...)
+	r.mutex.Unlock()
+	sort.SliceStable(references, func(i, j int) bool {
+		if references[i].Path != references[j].Path {
+			return references[i].Path < references[j].Path
+		}
+		if references[i].Line != references[j].Line {
+			return references[i].Line < references[j].Line
+		}
+		return references[i].Column < references[j].Column
+	})
+
+	g := &pathGraph{hops: map[fileKey][]Hop{}, files: map[string][]fileKey{}}
+	seen := map[fileKey]map[*deps.Dependency]bool{}
+	for _, reference := range references {
+		file := fileKey{Repo: reference.Repo, Path: reference.File}
+		if seen[file] == nil {
+			seen[file] = map[*deps.Dependency]bool{}
+			g.files[file.Repo] = append(g.files[file.Repo], file)
+		}
+		if seen[file][reference.Dependency] {
+			continue
+		}
+		seen[file][reference.Dependency] = true
+		g.hops[file] = append(g.hops[file], Hop{
+			Dependency: reference.Dependency,
+			Repo:       reference.Repo,
+			Path:       reference.Path,
+			Line:       reference.Line,
+			Column:     reference.Column,
+		})
+	}
+	return g
+}
+
+// Returns the hops that can be taken from the repo, if dep is nil, or else from the file
+// of dep. The hops from the repo are those from each of its files, so a dependency
+// referenced by several files of the repo can be reached from any of them.
+func (g *pathGraph) next(repo string, dep *deps.Dependency) []Hop {
+	if dep != nil {
+		return g.hops[fileKey{Repo: dep.Repo, Path: dep.Path}]
+	}
+	hops := []Hop{}
+	for _, file := range g.files[repo] {
+		hops = append(hops, g.hops[file]...)
+	}
+	return hops
+}
+
+// Returns true if the dependency is one of those a path should end at, which are given by
+// their names or Keys.
+func isTarget(dep *deps.Dependency, to string) bool {
+	return dep.Name == to || dep.Key() == to
+}
+
+// Returns the shortest chain of references from the repo to a dependency of the given
+// name (or Key), found by a breadth first search of the references found. False is
+// returned if there is no such chain.
+func (r *Result) ShortestPath(from string, to string) (Path, bool) {
+	g := r.pathGraph()
+	type step struct {
+		hop      Hop
+		previous *step
+	}
+	visited := map[*deps.Dependency]bool{}
+	queue := []*step{}
+	for _, hop := range g.next(from, nil) {
+		queue = append(queue, &step{hop: hop})
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		dep := current.hop.Dependency
+		if visited[dep] {
+			continue
+		}
+		visited[dep] = true
+		if isTarget(dep, to) {
+			hops := []Hop{}
+			for s := current; s != nil; s = s.previous {
+				hops = append([]Hop{s.hop}, hops...)
+			}
+			return Path{Repo: from, Hops: hops}, true
+		}
+		for _, hop := range g.next(from, dep) {
+			if !visited[hop.Dependency] {
+				queue = append(queue, &step{hop: hop, previous: current})
+			}
+		}
+	}
+	return Path{}, false
+}
+
+// Returns every chain of references from the repo to a dependency of the given name (or
+// Key) of no more than maxLength hops, which visit each dependency at most once. Chains
+// made up of the same references as a chain already found, such as those ending at a seed
+// dependency and at a file defining an entity of the same name, are only returned once.
+// The paths are sorted by their lengths, shortest first.
+func (r *Result) AllPaths(from string, to string, maxLength int) []Path {
+	g := r.pathGraph()
+	paths := []Path{}
+	found := map[string]bool{}
+	onPath := map[*deps.Dependency]bool{}
+	hops := []Hop{}
+	var visit func(dep *deps.Dependency)
+	visit = func(dep *deps.Dependency) {
+		if len(hops) == maxLength {
+			return
+		}
+		for _, hop := range g.next(from, dep) {
+			if onPath[hop.Dependency] {
+				continue
+			}
+			hops = append(hops, hop)
+			if isTarget(hop.Dependency, to) {
+				if locations := locationsOf(hops); !found[locations] {
+					found[locations] = true
+					paths = append(paths, Path{Repo: from, Hops: append([]Hop{}, hops...)})
+				}
+			} else {
+				onPath[hop.Dependency] = true
+				visit(hop.Dependency)
+				onPath[hop.Dependency] = false
+			}
+			hops = hops[:len(hops)-1]
+		}
+	}
+	visit(nil)
+	sort.SliceStable(paths, func(i, j int) bool {
+		return len(paths[i].Hops) < len(paths[j].Hops)
+	})
+	return paths
+}
+
+// Returns the locations of the references made by the hops, as a single string.
+func locationsOf(hops []Hop) string {
+	locations := []string{}
+	for _, hop := range hops {
+		locations = append(locations, fmt.Sprintf("%s:%s:%d:%d", hop.Repo, hop.Path, hop.Line, hop.Column))
+	}
+	return strings.Join(locations, " ")
+}
@@ -0,0 +1,112 @@
+package search
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a tree in which repo3 reaches orders directly, through vw_one, and through
+// vw_two and vw_one.
+func routesTree() fstest.MapFS {
+	return fstest.MapFS{
+		"repo1/one.sql":  {Data: []byte("CREATE VIEW vw_one AS\nSELECT * FROM orders\n")},
+		"repo2/two.sql":  {Data: []byte("CREATE VIEW vw_two AS\nSELECT * FROM vw_one\n")},
+		"repo3/Three.cs": {Data: []byte("class Three {\n  string a = \"vw_two\";\n  string b = \"vw_one\";\n}\n")},
+		"repo3/Four.cs":  {Data: []byte("class Four {\n  string c = \"orders\";\n}\n")},
+	}
+}
+
+func searchRoutes(t *testing.T) *Result {
+	searcher, _ := NewSearcher(Options{FS: []fs.FS{routesTree()}, Seeds: []string{"orders"}, Depth: UnlimitedDepth})
+	result, err := searcher.Search()
+	if err != nil {
+		t.Fatalf("Unexpected error searching: %v", err)
+	}
+	return result
+}
+
+func hopsOf(path Path) []string {
+	hops := []string{}
+	for _, hop := range path.Hops {
+		hops = append(hops, hop.Path+" -> "+hop.Dependency.DisplayName())
+	}
+	return hops
+}
+
+func TestResultShortestPath_ShouldReturnShortestChain(t *testing.T) {
+	result := searchRoutes(t)
+
+	path, ok := result.ShortestPath("repo2", "orders")
+
+	assert.True(t, ok)
+	assert.Equal(t, []string{"repo2/two.sql -> repo1:vw_one", "repo1/one.sql -> orders"}, hopsOf(path))
+	assert.Equal(t, 2, path.Hops[0].Line)
+}
+
+func TestResultShortestPath_ShouldReturnFalseWithoutChain(t *testing.T) {
+	result := searchRoutes(t)
+
+	_, ok := result.ShortestPath("repo1", "vw_two")
+
+	assert.False(t, ok)
+}
+
+func TestResultAllPaths_ShouldReturnEverySimplePathUpToMaxLength(t *testing.T) {
+	result := searchRoutes(t)
+
+	paths := result.AllPaths("repo3", "orders", 10)
+
+	assert.Equal(t, 3, len(paths))
+	assert.Equal(t, []string{"repo3/Four.cs -> orders"}, hopsOf(paths[0]))
+	assert.Equal(t, []string{"repo3/Three.cs -> repo1:vw_one", "repo1/one.sql -> orders"}, hopsOf(paths[1]))
+	assert.Equal(t, []string{
+		"repo3/Three.cs -> repo2:vw_two",
+		"repo2/two.sql -> repo1:vw_one",
+		"repo1/one.sql -> orders",
+	}, hopsOf(paths[2]))
+
+	assert.Equal(t, 2, len(result.AllPaths("repo3", "orders", 2)))
+}
+
+func TestResultAllPaths_ShouldReturnChainsOfTheSameReferencesOnce(t *testing.T) {
+	searcher, _ := NewSearcher(Options{
+		FS: []fs.FS{fstest.MapFS{
+			"repo1/a.sql": {Data: []byte("CREATE VIEW vw_A AS\nSELECT * FROM vw_B\n")},
+			"repo2/b.sql": {Data: []byte("CREATE VIEW vw_B AS\nSELECT * FROM vw_A\n")},
+		}},
+		Seeds: []string{"vw_B"},
+		Depth: UnlimitedDepth,
+	})
+	result, err := searcher.Search()
+	if err != nil {
+		t.Fatalf("Unexpected error searching: %v", err)
+	}
+
+	paths := result.AllPaths("repo1", "vw_B", 10)
+
+	assert.Len(t, paths, 1)
+}
+
+func TestResultAllPaths_ShouldReturnChainsFromEachFileOfTheRepo(t *testing.T) {
+	searcher, _ := NewSearcher(Options{
+		FS: []fs.FS{fstest.MapFS{
+			"repo1/a.sql": {Data: []byte("SELECT * FROM orders\n")},
+			"repo1/b.sql": {Data: []byte("SELECT 1\nSELECT * FROM orders\n")},
+		}},
+		Seeds: []string{"orders"},
+		Depth: 1,
+	})
+	result, err := searcher.Search()
+	if err != nil {
+		t.Fatalf("Unexpected error searching: %v", err)
+	}
+
+	paths := result.AllPaths("repo1", "orders", 10)
+
+	assert.Len(t, paths, 2)
+	assert.Equal(t, []string{"repo1/a.sql -> orders"}, hopsOf(paths[0]))
+	assert.Equal(t, []string{"repo1/b.sql -> orders"}, hopsOf(paths[1]))
+}
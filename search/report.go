@@ -0,0 +1,133 @@
+package search
+
+import (
+	"sort"
+
+	"github.com/andykuszyk/depgrok/deps"
+)
+
+// Represents a Result in a form that can be serialised, e.g. as JSON, for other tools to
+// consume. Dependencies are identified by their Keys, and files by their repos and their
+// paths within them, so that Reports of repos found in different places, e.g. on different
+// CI agents, can be compared.
+type Report struct {
+	Diagrams     []string           `json:"diagrams"`
+	Dependencies []ReportDependency `json:"dependencies"`
+	References   []ReportReference  `json:"references"`
+	Edges        []ReportEdge       `json:"edges"`
+	Cycles       [][]string         `json:"cycles"`
+}
+
+// Represents a dependency within a Report, along with the repos that reference it.
+type ReportDependency struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Level  int      `json:"level"`
+	Repo   string   `json:"repo,omitempty"`
+	Path   string   `json:"path,omitempty"`
+	Parent string   `json:"parent,omitempty"`
+	Repos  []string `json:"repos"`
+}
+
+// Represents a reference between dependencies within a Report, from the dependency of a
+// file to a dependency that the file references.
+type ReportEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Represents a reference within a Report.
+type ReportReference struct {
+	Dependency string `json:"dependency"`
+	Repo       string `json:"repo"`
+	Path       string `json:"path"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+}
+
+// Returns the Report of the Result, with the dependencies in the order in which they were
+// found, and the references sorted by their repos, paths and positions.
+func (r *Result) Report() Report {
+	report := Report{
+		Diagrams:     []string{},
+		Dependencies: []ReportDependency{},
+		References:   []ReportReference{},
+		Edges:        []ReportEdge{},
+		Cycles:       [][]string{},
+	}
+	for _, diagram := range r.Diagrams() {
+		report.Diagrams = append(report.Diagrams, diagram.Text)
+	}
+	for _, dep := range r.Dependencies.Slice() {
+		dependency := ReportDependency{
+			ID:    dep.Key(),
+			Name:  dep.Name,
+			Level: dep.Level,
+			Repo:  dep.Repo,
+			Path:  dep.Path,
+			Repos: []string{},
+		}
+		if dep.Parent != nil {
+			dependency.Parent = dep.Parent.Key()
+		}
+		for repo := range dep.Repos {
+			dependency.Repos = append(dependency.Repos, repo)
+		}
+		sort.Strings(dependency.Repos)
+		report.Dependencies = append(report.Dependencies, dependency)
+	}
+	for _, reference := range r.References {
+		report.References = append(report.References, ReportReference{
+			Dependency: reference.Dependency.Key(),
+			Repo:       reference.Repo,
+			Path:       reference.File,
+			Line:       reference.Line,
+			Column:     reference.Column,
+		})
+	}
+	sort.Slice(report.References, func(i, j int) bool {
+		a, b := report.References[i], report.References[j]
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Dependency < b.Dependency
+	})
+	r.mutex.Lock()
+	for from, tos := range r.edges {
+		for to := range tos {
+			report.Edges = append(report.Edges, ReportEdge{From: from.Key(), To: to.Key()})
+		}
+	}
+	r.mutex.Unlock()
+	sortEdges(report.Edges)
+	for _, cycle := range r.Cycles() {
+		report.Cycles = append(report.Cycles, keys(cycle))
+	}
+	return report
+}
+
+func sortEdges(edges []ReportEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+}
+
+func keys(dependencies []*deps.Dependency) []string {
+	keys := []string{}
+	for _, dep := range dependencies {
+		keys = append(keys, dep.Key())
+	}
+	return keys
+}
@@ -0,0 +1,33 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultReport_ShouldDescribeDependenciesAndReferences(t *testing.T) {
+	result := NewResult([]string{"orders"})
+	dep := result.Dependencies.Slice()[0]
+	result.Record(dep, "repo2", "repo2/OrderService.cs", 3, 5)
+	result.Record(dep, "repo1", "repo1/Checkout.cs", 1, 2)
+
+	report := result.Report()
+
+	assert.Equal(t, []string{"repo1 -> orders", "repo2 -> orders"}, report.Diagrams)
+	assert.Equal(t, ReportDependency{ID: "orders", Name: "orders", Repos: []string{"repo1", "repo2"}}, report.Dependencies[0])
+	assert.Equal(t, ReportDependency{
+		ID:     "repo2:OrderService.cs:OrderService",
+		Name:   "OrderService",
+		Level:  1,
+		Repo:   "repo2",
+		Path:   "OrderService.cs",
+		Parent: "orders",
+		Repos:  []string{},
+	}, report.Dependencies[1])
+	assert.Equal(t, []ReportReference{
+		{Dependency: "orders", Repo: "repo1", Path: "Checkout.cs", Line: 1, Column: 2},
+		{Dependency: "orders", Repo: "repo2", Path: "OrderService.cs", Line: 3, Column: 5},
+	}, report.References)
+	assert.Equal(t, [][]string{}, report.Cycles)
+}
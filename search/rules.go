@@ -0,0 +1,183 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Represents the rules read from a rules file by the check command, which are evaluated
+// against the Report of a search to stop unwanted references creeping into repos.
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Represents a rule that the references found by a search must satisfy. Repos and
+// dependencies are given by case-insensitive globs, such as frontend-* or payments.*. A
+// repo glob is matched against both the whole path of a repo, e.g. org/frontend-web, and
+// its last element, e.g. frontend-web.
+type Rule struct {
+	Name string `json:"name"`
+	// The repos that the rule applies to, or every repo if empty.
+	Repos []string `json:"repos"`
+	// The dependencies that the repos must not reference at all.
+	MustNotReference []string `json:"mustNotReference"`
+	// The dependencies that the repos must not reference any more than they did in the
+	// baseline snapshot, i.e. references may be removed, but not added.
+	NoNewReferences []string `json:"noNewReferences"`
+}
+
+// Represents a reference that breaks a Rule.
+type Violation struct {
+	Rule      string          `json:"rule"`
+	Reason    string          `json:"reason"`
+	Reference ReportReference `json:"reference"`
+}
+
+// Reads the Rules from the JSON file at the given path, checking that each rule has a name
+// of its own and that its globs are valid.
+func LoadRules(path string) (Rules, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return Rules{}, err
+	}
+	var rules Rules
+	if err := json.Unmarshal(contents, &rules); err != nil {
+		return Rules{}, fmt.Errorf("%s is not a rules file: %v", path, err)
+	}
+	names := map[string]bool{}
+	for i, rule := range rules.Rules {
+		if rule.Name == "" {
+			return Rules{}, fmt.Errorf("rule %d of %s has no name", i+1, path)
+		}
+		if names[rule.Name] {
+			return Rules{}, fmt.Errorf("rule %s is named more than once in %s", rule.Name, path)
+		}
+		names[rule.Name] = true
+		for _, globs := range [][]string{rule.Repos, rule.MustNotReference, rule.NoNewReferences} {
+			for _, glob := range globs {
+				if _, err := matchesNameGlob(glob, ""); err != nil {
+					return Rules{}, fmt.Errorf("rule %s has an invalid glob %s: %v", rule.Name, glob, err)
+				}
+			}
+		}
+	}
+	return rules, nil
+}
+
+// Returns true if any of the rules needs a baseline snapshot to be evaluated.
+func (r Rules) NeedBaseline() bool {
+	for _, rule := range r.Rules {
+		if len(rule.NoNewReferences) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the dependencies named by the rules that are not globs, which are the ones that
+// can be searched for when no others are given, without duplicates.
+func (r Rules) Seeds() []string {
+	seeds := []string{}
+	seen := map[string]bool{}
+	for _, rule := range r.Rules {
+		for _, name := range append(append([]string{}, rule.MustNotReference...), rule.NoNewReferences...) {
+			if !strings.ContainsAny(name, "*?[\\") && !seen[name] {
+				seen[name] = true
+				seeds = append(seeds, name)
+			}
+		}
+	}
+	return seeds
+}
+
+// Evaluates the rules against the references of the Report, returning a Violation for each
+// reference that breaks a rule, in the order of the rules. Rules with NoNewReferences are
+// only evaluated if a baseline is given. A reference is new if its file references the
+// dependency more times than it did in the baseline, in which case the last of its
+// references are reported.
+func (r Rules) Check(report Report, baseline *Report) []Violation {
+	violations := []Violation{}
+	names := dependencyNames(report)
+	allowed := map[referencingFile]int{}
+	if baseline != nil {
+		baselineNames := dependencyNames(*baseline)
+		for _, reference := range baseline.References {
+			allowed[referencingFileOf(reference, baselineNames)]++
+		}
+	}
+	for _, rule := range r.Rules {
+		for _, reference := range report.References {
+			if rule.AppliesTo(reference.Repo) && matchesAny(rule.MustNotReference, names[reference.Dependency]) {
+				violations = append(violations, Violation{
+					Rule:      rule.Name,
+					Reason:    fmt.Sprintf("%s must not reference %s", reference.Repo, names[reference.Dependency]),
+					Reference: reference,
+				})
+			}
+		}
+		if baseline == nil || len(rule.NoNewReferences) == 0 {
+			continue
+		}
+		seen := map[referencingFile]int{}
+		for _, reference := range report.References {
+			if !rule.AppliesTo(reference.Repo) || !matchesAny(rule.NoNewReferences, names[reference.Dependency]) {
+				continue
+			}
+			file := referencingFileOf(reference, names)
+			seen[file]++
+			if seen[file] > allowed[file] {
+				violations = append(violations, Violation{
+					Rule:      rule.Name,
+					Reason:    fmt.Sprintf("%s has a new reference to %s", reference.Repo, names[reference.Dependency]),
+					Reference: reference,
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// Identifies the references from a file to a dependency, which are counted to find new
+// references, regardless of where in the file they are. The file is identified by its
+// path within its repo, and the dependency by its name, so that a baseline taken from
+// repos cloned elsewhere, such as on another CI agent, can still be compared.
+type referencingFile struct {
+	Dependency string
+	Repo       string
+	Path       string
+}
+
+func referencingFileOf(reference ReportReference, names map[string]string) referencingFile {
+	return referencingFile{Dependency: names[reference.Dependency], Repo: reference.Repo, Path: reference.Path}
+}
+
+// Returns the name of each dependency of the Report, by its ID.
+func dependencyNames(report Report) map[string]string {
+	names := map[string]string{}
+	for _, dep := range report.Dependencies {
+		names[dep.ID] = dep.Name
+	}
+	return names
+}
+
+// Returns true if the rule applies to the repo, either because it has no Repos, or because
+// one of them matches the whole path or last element of the repo.
+func (rule Rule) AppliesTo(repo string) bool {
+	return len(rule.Repos) == 0 || matchesAny(rule.Repos, repo) || matchesAny(rule.Repos, path.Base(repo))
+}
+
+func matchesAny(globs []string, name string) bool {
+	for _, glob := range globs {
+		if matched, _ := matchesNameGlob(glob, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesNameGlob(glob string, name string) (bool, error) {
+	return path.Match(strings.ToLower(glob), strings.ToLower(name))
+}
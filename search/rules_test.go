@@ -0,0 +1,97 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func checkedReport(references map[string][]int) Report {
+	result := NewResult([]string{"payments.cards", "legacy_orders"})
+	for _, dep := range result.Dependencies.Slice() {
+		for path, lines := range references {
+			for _, line := range lines {
+				if filepath.Ext(path) == ".js" && dep.Name == "payments.cards" || filepath.Ext(path) == ".sql" && dep.Name == "legacy_orders" {
+					result.Record(dep, filepath.Dir(path), path, line, 1)
+				}
+			}
+		}
+	}
+	return result.Report()
+}
+
+func TestRulesCheck_ShouldReportReferencesFromReposThatMustNotMakeThem(t *testing.T) {
+	rules := Rules{Rules: []Rule{{Name: "no payments", Repos: []string{"frontend-*"}, MustNotReference: []string{"payments.*"}}}}
+	report := checkedReport(map[string][]int{
+		"org/frontend-web/cart.js":  {3},
+		"org/backend-api/charge.js": {5},
+	})
+
+	violations := rules.Check(report, nil)
+
+	assert.Len(t, violations, 1)
+	assert.Equal(t, "no payments", violations[0].Rule)
+	assert.Equal(t, "org/frontend-web must not reference payments.cards", violations[0].Reason)
+	assert.Equal(t, "cart.js", violations[0].Reference.Path)
+}
+
+func TestRulesCheck_ShouldReportReferencesBeyondTheBaseline(t *testing.T) {
+	rules := Rules{Rules: []Rule{{Name: "no new legacy", NoNewReferences: []string{"LEGACY_*"}}}}
+	baseline := checkedReport(map[string][]int{"repo1/a.sql": {1, 2}})
+	report := checkedReport(map[string][]int{"repo1/a.sql": {4, 5}, "repo2/b.sql": {7}})
+
+	violations := rules.Check(report, &baseline)
+
+	assert.Len(t, violations, 1)
+	assert.Equal(t, "repo2 has a new reference to legacy_orders", violations[0].Reason)
+	assert.Empty(t, rules.Check(report, nil))
+	assert.True(t, rules.NeedBaseline())
+}
+
+func TestLoadRules_ShouldRejectInvalidGlobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(`{"rules": [{"name": "bad", "mustNotReference": ["[payments"]}]}`), 0644)
+
+	_, err := LoadRules(path)
+
+	assert.NotNil(t, err)
+}
+
+func TestLoadRules_ShouldRejectDuplicateNames(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(`{"rules": [
+		{"name": "no payments", "mustNotReference": ["payments.*"]},
+		{"name": "no payments", "mustNotReference": ["payments.cards"]}
+	]}`), 0644)
+
+	_, err := LoadRules(path)
+
+	assert.NotNil(t, err)
+}
+
+func TestRulesSeeds_ShouldReturnDependenciesThatAreNotGlobs(t *testing.T) {
+	rules := Rules{Rules: []Rule{
+		{Name: "no payments", Repos: []string{"frontend-*"}, MustNotReference: []string{"payments.*", "billing"}},
+		{Name: "no new legacy", NoNewReferences: []string{"legacy_orders", "billing"}},
+	}}
+
+	assert.Equal(t, []string{"billing", "legacy_orders"}, rules.Seeds())
+}
+
+func TestRulesCheck_ShouldCompareFilesByTheirPathsWithinTheirRepos(t *testing.T) {
+	rules := Rules{Rules: []Rule{{Name: "no new legacy", NoNewReferences: []string{"legacy_*"}}}}
+	baseline := checkedReport(map[string][]int{"/agent1/repos/repo1/a.sql": {1}})
+	report := checkedReport(map[string][]int{"/agent2/repos/repo1/a.sql": {1}})
+	for i := range baseline.References {
+		baseline.References[i].Repo = "repo1"
+	}
+	for i := range report.References {
+		report.References[i].Repo = "repo1"
+	}
+
+	violations := rules.Check(report, &baseline)
+
+	assert.Empty(t, violations)
+}
@@ -0,0 +1,86 @@
+package search
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/andykuszyk/depgrok/deps"
+)
+
+// The size of the buffer used to read files whilst they are scanned. Lines longer than
+// this are scanned in chunks, so memory use stays flat regardless of the file's size.
+const scanBufferSize = 64 * 1024
+
+// Scans the contents of r line by line, through a buffer of the given size, for references
+// found by the given matcher, calling onMatch with the match, line and column (both
+// starting at 1, with the column counted in characters) of each reference found.
+//
+// Lines longer than the read buffer are scanned a chunk at a time. A reference ending near
+// the end of a chunk might yet be cut short or extended by the next one (e.g. orders
+// followed by _archive), so it is left for the next scan, which is given the end of the
+// chunk along with the next, so that references spanning a boundary are found exactly
+// once.
+func scanReader(r io.Reader, matcher deps.Matcher, bufferSize int, onMatch func(match deps.Match, line int, column int)) error {
+	// References ending within this many bytes of the end of a chunk are left for the next
+	// scan, which must also be given the rest of them, and the character preceding them.
+	overlap := matcher.MaxLen() + 1
+
+	reader := bufio.NewReaderSize(r, bufferSize)
+	carry := ""
+	// References ending within this many bytes of the start of the text were reported by
+	// the previous scan.
+	reported := 0
+	line := 1
+	// The number of characters in the line before the chunk.
+	lineOffset := 0
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull && err != io.EOF {
+			return err
+		}
+		text := carry + string(chunk)
+		limit := len(text)
+		if err == bufio.ErrBufferFull {
+			limit -= overlap
+		}
+		for _, match := range matcher.FindAll(text) {
+			if match.End <= reported || match.End > limit {
+				continue
+			}
+			onMatch(match, line, lineOffset-countRunes(carry)+countRunes(text[:match.Start])+1)
+		}
+
+		switch {
+		case err == io.EOF:
+			return nil
+		case err == bufio.ErrBufferFull:
+			lineOffset += countRunes(string(chunk))
+			carry = text
+			if len(text) > 2*overlap {
+				carry = text[len(text)-2*overlap:]
+			}
+			reported = limit - (len(text) - len(carry))
+			if reported < 0 {
+				reported = 0
+			}
+		default:
+			line++
+			lineOffset = 0
+			carry = text[len(text)-1:]
+			reported = len(carry)
+		}
+	}
+}
+
+// Returns the number of characters in text, which is the number of bytes that do not
+// continue a UTF-8 encoded character. Unlike utf8.RuneCountInString, this adds up across
+// chunks that split a character in two.
+func countRunes(text string) int {
+	count := 0
+	for i := 0; i < len(text); i++ {
+		if text[i]&0xC0 != 0x80 {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,140 @@
+package search
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andykuszyk/depgrok/deps"
+)
+
+type scanMatch struct {
+	Name   string
+	Line   int
+	Column int
+}
+
+func scan(t *testing.T, text string, bufferSize int, names ...string) []scanMatch {
+	return scanWith(t, text, bufferSize, "word", names...)
+}
+
+func scanWith(t *testing.T, text string, bufferSize int, matcherName string, names ...string) []scanMatch {
+	dependencies := []*deps.Dependency{}
+	for _, name := range names {
+		dependencies = append(dependencies, &deps.Dependency{Name: name})
+	}
+	matches := []scanMatch{}
+	matcher, err := deps.NewMatcher(matcherName, dependencies)
+	if err != nil {
+		t.Fatalf("Unexpected error building the %s matcher: %v", matcherName, err)
+	}
+	err = scanReader(strings.NewReader(text), matcher, bufferSize, func(match deps.Match, line int, column int) {
+		matches = append(matches, scanMatch{Name: match.Dependency.Name, Line: line, Column: column})
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error scanning text: %v", err)
+	}
+	return matches
+}
+
+func TestScanReader_ShouldReportLineAndColumn(t *testing.T) {
+	matches := scan(t, "first line\nuses foo here\n", scanBufferSize, "foo")
+
+	if len(matches) != 1 {
+		t.Fatalf("Expected 1 match, but got %d", len(matches))
+	}
+	if matches[0].Line != 2 || matches[0].Column != 6 {
+		t.Errorf("Expected a match at 2:6, but got %d:%d", matches[0].Line, matches[0].Column)
+	}
+}
+
+func TestScanReader_ShouldMatchEachDependency(t *testing.T) {
+	matches := scan(t, " foo\nbar foo\nbar\n", scanBufferSize, "foo", "bar")
+
+	if len(matches) != 4 {
+		t.Errorf("Expected 4 matches, but got %d: %v", len(matches), matches)
+	}
+}
+
+func TestScanReader_ShouldNotMatchAtStartOfText(t *testing.T) {
+	matches := scan(t, "foo bar\n", scanBufferSize, "foo")
+
+	if len(matches) != 0 {
+		t.Errorf("Expected no matches, but got %v", matches)
+	}
+}
+
+func TestScanReader_ShouldMatchAcrossBufferBoundaries(t *testing.T) {
+	bufferSize := 16
+
+	// Place a reference at every offset relative to the buffer boundary, on one long line.
+	for padding := 0; padding < bufferSize; padding++ {
+		text := strings.Repeat(" ", padding) + " dependency " + strings.Repeat("x", 40) + "\n"
+
+		matches := scan(t, text, bufferSize, "dependency")
+
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match with padding %d, but got %d", padding, len(matches))
+		}
+		if matches[0].Column != padding+2 {
+			t.Errorf("Expected column %d with padding %d, but got %d", padding+2, padding, matches[0].Column)
+		}
+	}
+}
+
+func TestScanReader_ShouldMatchNamesEndingAtBufferBoundariesOnce(t *testing.T) {
+	bufferSize := 16
+
+	for _, matcherName := range []string{"word", "token", "sql"} {
+		// Place a reference at every offset relative to the buffer boundary, including
+		// ending exactly at it, on one long line.
+		for padding := 0; padding < 2*bufferSize; padding++ {
+			text := strings.Repeat(" ", padding) + " orders " + strings.Repeat("x", 40) + "\n"
+
+			matches := scanWith(t, text, bufferSize, matcherName, "orders")
+
+			if len(matches) != 1 {
+				t.Fatalf("Expected 1 match with the %s matcher and padding %d, but got %v", matcherName, padding, matches)
+			}
+			if matches[0].Column != padding+2 {
+				t.Errorf("Expected column %d with the %s matcher and padding %d, but got %d", padding+2, matcherName, padding, matches[0].Column)
+			}
+		}
+	}
+}
+
+func TestScanReader_ShouldNotMatchNamesContinuedAfterBufferBoundaries(t *testing.T) {
+	bufferSize := 16
+
+	// The word matcher takes underscores to separate words, so finds orders in
+	// orders_archive wherever it is.
+	for _, matcherName := range []string{"token", "sql"} {
+		for padding := 0; padding < 2*bufferSize; padding++ {
+			text := strings.Repeat(" ", padding) + " orders_archive " + strings.Repeat("x", 40) + "\n"
+
+			matches := scanWith(t, text, bufferSize, matcherName, "orders")
+
+			if len(matches) != 0 {
+				t.Fatalf("Expected no matches with the %s matcher and padding %d, but got %v", matcherName, padding, matches)
+			}
+		}
+	}
+}
+
+func TestScanReader_ShouldCountColumnsInCharacters(t *testing.T) {
+	bufferSize := 16
+
+	// Place multi-byte characters before a reference, on either side of the buffer
+	// boundary.
+	for padding := 0; padding < 2*bufferSize; padding++ {
+		text := strings.Repeat("é", padding) + " orders " + strings.Repeat("x", 40) + "\n"
+
+		matches := scan(t, text, bufferSize, "orders")
+
+		if len(matches) != 1 {
+			t.Fatalf("Expected 1 match with padding %d, but got %v", padding, matches)
+		}
+		if matches[0].Column != padding+2 {
+			t.Errorf("Expected column %d with padding %d, but got %d", padding+2, padding, matches[0].Column)
+		}
+	}
+}
@@ -0,0 +1,701 @@
+// Package search finds references to a set of dependencies within directories of code
+// repositories, building a graph of the repos and files that depend on them, directly or
+// indirectly.
+//
+// A search is configured with Options and run by a Searcher:
+//
+//	searcher, err := search.NewSearcher(search.Options{
+//		Roots: []string{"/path/to/repos"},
+//		Seeds: []string{"orders", "customers"},
+//		Depth: 2,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	result, err := searcher.Search()
+package search
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andykuszyk/depgrok/deps"
+)
+
+// Configures a Searcher.
+type Options struct {
+	// The directories to search, each of which contains a directory per repo.
+	Roots []string
+
+	// File systems to search as well as, or instead of, Roots, each of which contains a
+	// directory per repo. The paths of the files found within them are reported as their
+	// slash-separated paths within the file system, e.g. repo1/orders.sql.
+	FS []fs.FS
+
+	// File systems to search, each of which holds a single repo, keyed by the name of the
+	// repo. The paths of the files found within them are reported as the name of the repo
+	// followed by their slash-separated path within the file system, e.g. repo1/orders.sql.
+	Repos map[string]fs.FS
+
+	// The names of the dependencies to search for.
+	Seeds []string
+
+	// The depth of the dependency tree to construct. A depth of 1 finds the repos that
+	// reference the seeds directly; a depth of 2 also finds those that reference files
+	// which reference the seeds, and so on. A depth of UnlimitedDepth searches level after
+	// level until no new dependencies are found, up to MaxDepth levels.
+	Depth int
+
+	// The most levels searched with a Depth of UnlimitedDepth, which guards against
+	// searches that would otherwise run for a very long time. Defaults to DefaultMaxDepth.
+	MaxDepth int
+
+	// Globs of files to exclude from the search, or to include in it at the exclusion of
+	// all others. Only one of Exclude and Include may be given.
+	Exclude []string
+	Include []string
+
+	// If true, zip archives (including jar, war, ear and nupkg files) and gzipped tar
+	// archives are searched as if their entries were files in the repo, with the path of
+	// each entry being reported after that of the archive, e.g. repo1/orders.nupkg!/orders.sql.
+	Archives bool
+
+	// How the files within Roots and FS are divided into repos, as per WalkOptions. By
+	// default, repos are detected by their .git directories. The RepoMarkers also divide
+	// the file systems of Repos, e.g. giving ModuleMarkers reports each module of a
+	// monorepo as a repo of its own.
+	RepoDepth   int
+	RepoMarkers []string
+
+	// The name of the registered deps.Matcher used to find references to dependencies that
+	// do not name their own Matcher. Defaults to deps.DefaultMatcher.
+	Matcher string
+
+	// Rules selecting a different default Matcher for the files matching their globs. The
+	// first rule matching a file is used, falling back to Matcher if none of them match.
+	MatcherRules []MatcherRule
+
+	// Decides which file names are promoted to intermediate dependencies when searching
+	// beyond the first level. Defaults to DefaultNameFilter.
+	NameFilter *NameFilter
+
+	// If true, files found to reference a dependency become dependencies of the next level
+	// by their names alone. Otherwise, the entities they define (e.g. the procedures
+	// created by a SQL script, or the classes declared in a C# file) are used in their
+	// place, where an Extractor is registered for their extension and finds any. Files
+	// longer than 16 MiB that are not held in the cache are always used by their names.
+	FileNamesOnly bool
+
+	// The number of files to search in parallel. Defaults to the number of CPUs.
+	Workers int
+
+	// The number of bytes of file contents to hold in memory between levels of the
+	// search. Files that do not fit are re-read from disk for each level beyond the first.
+	// Defaults to DefaultCacheBudget; a CacheBudget of NoCache holds none in memory.
+	CacheBudget int64
+
+	// If set, called with the level and path of each file as it is searched. It may be
+	// called from several goroutines at once.
+	Progress func(level int, path string)
+}
+
+// The Depth that searches until no new dependencies are found.
+const UnlimitedDepth = -1
+
+// The most levels searched with a Depth of UnlimitedDepth, unless the options give another
+// MaxDepth.
+const DefaultMaxDepth = 10
+
+// The number of bytes of file contents held in memory between levels, unless the options
+// give another CacheBudget.
+const DefaultCacheBudget = 256 * 1024 * 1024
+
+// The CacheBudget that holds no file contents in memory between levels.
+const NoCache = -1
+
+// Searches directories of code repositories for references to dependencies.
+type Searcher struct {
+	options Options
+}
+
+// Constructs a new Searcher, returning an error if the options are invalid.
+func NewSearcher(options Options) (*Searcher, error) {
+	if len(options.Roots) == 0 && len(options.FS) == 0 && len(options.Repos) == 0 {
+		return nil, errors.New("at least one root directory or file system must be given")
+	}
+	if len(options.Seeds) == 0 {
+		return nil, errors.New("at least one dependency must be given")
+	}
+	if len(options.Exclude) > 0 && len(options.Include) > 0 {
+		return nil, errors.New("exclude globs cannot be used in conjunction with include globs")
+	}
+	if options.Depth < 1 && options.Depth != UnlimitedDepth {
+		return nil, errors.New("the depth must be at least 1")
+	}
+	if options.MaxDepth < 0 {
+		return nil, errors.New("the maximum depth cannot be negative")
+	}
+	if options.MaxDepth == 0 {
+		options.MaxDepth = DefaultMaxDepth
+	}
+	if options.RepoDepth < 0 {
+		return nil, errors.New("the repo depth cannot be negative")
+	}
+	if options.Workers < 0 {
+		return nil, errors.New("the number of workers cannot be negative")
+	}
+	if options.Workers == 0 {
+		options.Workers = runtime.NumCPU()
+	}
+	if options.CacheBudget < 0 && options.CacheBudget != NoCache {
+		return nil, errors.New("the cache budget cannot be negative")
+	}
+	if options.CacheBudget == 0 {
+		options.CacheBudget = DefaultCacheBudget
+	}
+	if options.Matcher == "" {
+		options.Matcher = deps.DefaultMatcher
+	}
+	if !deps.HasMatcher(options.Matcher) {
+		return nil, fmt.Errorf("no matcher is registered as %q", options.Matcher)
+	}
+	for _, rule := range options.MatcherRules {
+		if !deps.HasMatcher(rule.Matcher) {
+			return nil, fmt.Errorf("no matcher is registered as %q, as given for %s", rule.Matcher, rule.Glob)
+		}
+		if _, err := filepath.Match(rule.Glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %s: %v", rule.Glob, err)
+		}
+	}
+	if options.NameFilter != nil {
+		for _, stop := range options.NameFilter.StopList {
+			if _, err := path.Match(stop, ""); err != nil {
+				return nil, fmt.Errorf("invalid glob %s in the stop list: %v", stop, err)
+			}
+		}
+	}
+	return &Searcher{options: options}, nil
+}
+
+// Selects the name of the deps.Matcher used by default for files matching Glob, which is
+// evaluated relative to the directory containing each file, e.g. *.sql.
+type MatcherRule struct {
+	Glob    string
+	Matcher string
+}
+
+// Holds the Matchers used to search each file for the dependencies of a single level,
+// built for each of the default Matchers that the options' rules might select.
+type fileMatchers struct {
+	rules    []MatcherRule
+	fallback string
+	matchers map[string]deps.Matcher
+}
+
+// Builds the Matchers used to search files for the given dependencies.
+func (s *Searcher) buildMatchers(dependencies []*deps.Dependency) (*fileMatchers, error) {
+	f := &fileMatchers{
+		rules:    s.options.MatcherRules,
+		fallback: s.options.Matcher,
+		matchers: map[string]deps.Matcher{},
+	}
+	names := []string{s.options.Matcher}
+	for _, rule := range s.options.MatcherRules {
+		names = append(names, rule.Matcher)
+	}
+	for _, name := range names {
+		if _, ok := f.matchers[name]; ok {
+			continue
+		}
+		matcher, err := deps.BuildMatcher(dependencies, name)
+		if err != nil {
+			return nil, err
+		}
+		f.matchers[name] = matcher
+	}
+	return f, nil
+}
+
+// Returns the Matcher used to search the file at the given path.
+func (f *fileMatchers) forPath(path string) deps.Matcher {
+	for _, rule := range f.rules {
+		if matchesGlob(path, []string{rule.Glob}) {
+			return f.matchers[rule.Matcher]
+		}
+	}
+	return f.matchers[f.fallback]
+}
+
+// Represents a reference to a dependency, found in a file within a repo. The line and
+// column start at 1, and are 0 if they are not known. The column is counted in characters
+// (Unicode code points) rather than bytes.
+type Reference struct {
+	Dependency *deps.Dependency
+	Repo       string
+	Path       string
+	// The slash-separated path of the file within its repo, e.g. db/orders.sql, which,
+	// unlike Path, does not depend on where the repos were found.
+	File   string
+	Line   int
+	Column int
+}
+
+// Represents the result of a search: the graph of dependencies found, with each linked to
+// the repos that reference it and to the dependency it was found to reference (its Parent),
+// along with the location of every reference found.
+type Result struct {
+	Dependencies *deps.Dependencies
+	References   []Reference
+
+	// The repos in which files were searched, in the order in which they were found.
+	Repos []string
+
+	// The number of levels that were searched, which is less than the depth if there were
+	// no dependencies left to search for. Truncated is true if the search was stopped by
+	// the MaxDepth of a search of UnlimitedDepth whilst there were still dependencies left.
+	Levels    int
+	Truncated bool
+
+	// Decides which file names are promoted to intermediate dependencies by Record.
+	NameFilter NameFilter
+
+	// The references between dependencies, from the intermediate dependency of each file
+	// found to reference another dependency, to that dependency. Unlike the Parent of each
+	// Dependency, these include the references found from files that were already
+	// dependencies, which is how cycles are found.
+	edges map[*deps.Dependency]map[*deps.Dependency]bool
+	mutex sync.Mutex
+}
+
+// Constructs a new Result, with a dependency for each of the given seeds, which promotes
+// file names to intermediate dependencies according to DefaultNameFilter.
+func NewResult(seeds []string) *Result {
+	return &Result{Dependencies: deps.BuildDependencies(seeds), NameFilter: DefaultNameFilter()}
+}
+
+// Records a reference to dep from the file at path in the repo, and adds the file as a
+// dependency of the next level, if it is not already present. The new dependency is found
+// by the name of the file, but is identified by its repo and its path within the repo, so
+// that files of the same name in different places are not conflated. References from a
+// file sharing the dependency's own name are ignored, and files whose names are not
+// allowed by the NameFilter are not added as dependencies.
+//
+// The path is taken to be relative to the directory containing the repo, e.g.
+// repo1/db/orders.sql, from which the path of the file within the repo is found. Use
+// RecordReference for files found elsewhere.
+func (r *Result) Record(dep *deps.Dependency, repo string, path string, line int, column int) {
+	r.RecordDefinitions(dep, repo, path, line, column, nil)
+}
+
+// Records a reference as per Record, but adds the given names of the entities defined by
+// the file (e.g. the procedures created by a SQL script) as dependencies of the next level,
+// in place of the name of the file, which is only used if no names are given. A file
+// defining dep is not taken to define a dependency on itself, and references from the file
+// dep was found in, or from a file defining nothing but dep, are ignored.
+func (r *Result) RecordDefinitions(dep *deps.Dependency, repo string, path string, line int, column int, names []string) {
+	r.RecordReference(Reference{
+		Dependency: dep,
+		Repo:       repo,
+		Path:       path,
+		File:       strings.TrimPrefix(filepath.ToSlash(path), repo+"/"),
+		Line:       line,
+		Column:     column,
+	}, names)
+}
+
+// Records the reference, along with the names of the entities defined by its file, as per
+// RecordDefinitions.
+func (r *Result) RecordReference(reference Reference, names []string) {
+	dep := reference.Dependency
+	repo := reference.Repo
+	if dep.Repo == repo && dep.Path == reference.File {
+		return
+	}
+	if len(names) == 0 {
+		names = []string{StripExtension(path.Base(reference.File))}
+	}
+	defined := []string{}
+	for _, name := range names {
+		if name != dep.Name {
+			defined = append(defined, name)
+		}
+	}
+	if len(defined) == 0 {
+		return
+	}
+	dep.AddRepo(repo)
+	for _, name := range defined {
+		parentDependency := &deps.Dependency{
+			Name:   name,
+			Parent: dep,
+			Level:  dep.Level + 1,
+			Repo:   repo,
+			Path:   reference.File,
+		}
+		if !r.NameFilter.Allows(name) {
+			continue
+		}
+		if err := r.Dependencies.Add(parentDependency); err != nil {
+			// The file was already found to reference a dependency, so the reference is
+			// recorded against the existing dependency.
+			parentDependency = r.Dependencies.Get(parentDependency.Key())
+		}
+		r.addEdge(parentDependency, dep)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.References = append(r.References, reference)
+}
+
+// Returns the dependencies found at the given level, which are searched for at that level
+// of the search.
+func (r *Result) LevelDependencies(level int) []*deps.Dependency {
+	dependencies := []*deps.Dependency{}
+	for _, dep := range r.Dependencies.Slice() {
+		if dep.Level == level {
+			dependencies = append(dependencies, dep)
+		}
+	}
+	return dependencies
+}
+
+// Records that the from dependency references the to dependency.
+func (r *Result) addEdge(from *deps.Dependency, to *deps.Dependency) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.edges == nil {
+		r.edges = map[*deps.Dependency]map[*deps.Dependency]bool{}
+	}
+	if r.edges[from] == nil {
+		r.edges[from] = map[*deps.Dependency]bool{}
+	}
+	r.edges[from][to] = true
+}
+
+// Returns the diagrams of the dependency chains found, sorted ready for display.
+func (r *Result) Diagrams() []deps.DependencyDiagram {
+	return r.Dependencies.BuildDiagrams()
+}
+
+// Runs the search, returning its result, or the first error encountered. The file tree
+// is only walked once, with deeper levels being searched using the files cached on the
+// first pass.
+func (s *Searcher) Search() (*Result, error) {
+	result := NewResult(s.options.Seeds)
+	if s.options.NameFilter != nil {
+		result.NameFilter = *s.options.NameFilter
+	}
+	cache := newFileCache(s.options.CacheBudget)
+	depth := s.options.Depth
+	if depth == UnlimitedDepth {
+		depth = s.options.MaxDepth
+	}
+	for level := 0; ; level++ {
+		// Only the dependencies at the current level are searched for, in order to avoid
+		// worrying about new dependencies of a higher level that are collected on this pass.
+		levelDependencies := result.LevelDependencies(level)
+		if len(levelDependencies) == 0 {
+			break
+		}
+		if level == depth {
+			result.Truncated = s.options.Depth == UnlimitedDepth
+			break
+		}
+		result.Levels++
+		matchers, err := s.buildMatchers(levelDependencies)
+		if err != nil {
+			return nil, err
+		}
+
+		if level == 0 {
+			err = s.searchRoots(result, matchers, level, cache)
+		} else {
+			err = s.searchCache(result, matchers, level, cache)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Returns true if the file at the given slash-separated path within a repo would be
+// searched, according to the options' globs.
+func (s *Searcher) Searches(path string) bool {
+	include := s.options.Include
+	return shouldSearchEntry(path, s.options.Exclude, include) && (len(include) == 0 || matchesGlob(path, include))
+}
+
+// Returns the Matcher that would be used to search the file at the given path for the
+// given dependencies.
+func (s *Searcher) MatcherFor(path string, dependencies []*deps.Dependency) (deps.Matcher, error) {
+	matchers, err := s.buildMatchers(dependencies)
+	if err != nil {
+		return nil, err
+	}
+	return matchers.forPath(path), nil
+}
+
+// Collects the first error reported by any of a pool's workers.
+type firstError struct {
+	err   error
+	mutex sync.Mutex
+}
+
+func (e *firstError) set(err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func (e *firstError) get() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.err
+}
+
+// Represents a file found by walking the file tree, waiting to be searched by a worker.
+// Path is the path reported for the file, File its path within its repo, and Name its path
+// within FS.
+type searchJob struct {
+	Repo string
+	Path string
+	File string
+	FS   fs.FS
+	Name string
+	Info fs.FileInfo
+}
+
+// Represents a file system to be searched, along with the directory joined to the paths of
+// the files within it when they are reported, if it was given as one of the options' Roots,
+// and the name of the repo it holds, if it was given as one of the options' Repos or is a
+// root that is itself a repo.
+type searchRoot struct {
+	FS   fs.FS
+	Dir  string
+	Repo string
+}
+
+// Returns the file systems to search, with the directories given as Roots first, and the
+// Repos last, in order of their names.
+func (s *Searcher) roots() []searchRoot {
+	roots := []searchRoot{}
+	for _, dir := range s.options.Roots {
+		repo := RootRepo(dir, WalkOptions{RepoDepth: s.options.RepoDepth, RepoMarkers: s.options.RepoMarkers})
+		roots = append(roots, searchRoot{FS: os.DirFS(dir), Dir: dir, Repo: repo})
+	}
+	for _, fsys := range s.options.FS {
+		roots = append(roots, searchRoot{FS: fsys})
+	}
+	repos := []string{}
+	for repo := range s.options.Repos {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	for _, repo := range repos {
+		roots = append(roots, searchRoot{FS: s.options.Repos[repo], Repo: repo})
+	}
+	return roots
+}
+
+// Walks the roots, searching each file for references to dependencies at the given level.
+// The walk itself happens on the calling goroutine, which feeds the files it finds to a
+// fixed pool of workers that search them. Each file searched is added to the cache, so
+// that further levels can be searched with searchCache.
+func (s *Searcher) searchRoots(result *Result, matchers *fileMatchers, level int, cache *fileCache) error {
+	jobs := make(chan searchJob, s.options.Workers)
+	errs := firstError{}
+	wg := sync.WaitGroup{}
+	wg.Add(s.options.Workers)
+	for i := 0; i < s.options.Workers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if errs.get() == nil {
+					s.progress(level, job.Path)
+					file, err := cache.add(job)
+					if err == nil {
+						err = s.searchFile(file, result, matchers.forPath(file.Path))
+					}
+					if err != nil {
+						errs.set(err)
+					}
+				}
+				releaseEntry(job.FS)
+			}
+		}()
+	}
+
+	enqueue := func(job searchJob) error {
+		if err := errs.get(); err != nil {
+			return err
+		}
+		acquireEntry(job.FS)
+		jobs <- job
+		return nil
+	}
+	// Archives must be walked even if they do not match the include globs, since their
+	// entries might, so the include globs are applied here rather than by the walk.
+	walkOptions := WalkOptions{
+		Exclude:     s.options.Exclude,
+		Include:     s.options.Include,
+		RepoDepth:   s.options.RepoDepth,
+		RepoMarkers: s.options.RepoMarkers,
+	}
+	if s.options.Archives {
+		walkOptions.Include = nil
+	}
+	repos := map[string]bool{}
+	for _, root := range s.roots() {
+		root := root
+		err := walkFS(root.FS, root.Repo, walkOptions, func(repo string, name string, info fs.FileInfo) error {
+			if !repos[repo] {
+				repos[repo] = true
+				result.Repos = append(result.Repos, repo)
+			}
+			path := name
+			switch {
+			case root.Dir != "":
+				path = filepath.Join(root.Dir, filepath.FromSlash(name))
+			case root.Repo != "":
+				path = root.Repo + "/" + name
+			}
+			file := name
+			if root.Repo != "" {
+				file = root.Repo + "/" + name
+			}
+			file = strings.TrimPrefix(file, repo+"/")
+			if s.options.Archives && isArchive(name) {
+				return s.walkArchive(repo, path, file, root.FS, name, info, cache, enqueue)
+			}
+			if len(s.options.Include) > 0 && !matchesGlob(name, s.options.Include) {
+				return nil
+			}
+			return enqueue(searchJob{Repo: repo, Path: path, File: file, FS: root.FS, Name: name, Info: info})
+		})
+		if err != nil {
+			errs.set(err)
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return errs.get()
+}
+
+// Searches the files collected in the cache by searchRoots for references to dependencies
+// at the given level, using a fixed pool of workers, without walking the file tree again.
+func (s *Searcher) searchCache(result *Result, matchers *fileMatchers, level int, cache *fileCache) error {
+	jobs := make(chan *cachedFile, s.options.Workers)
+	errs := firstError{}
+	wg := sync.WaitGroup{}
+	wg.Add(s.options.Workers)
+	for i := 0; i < s.options.Workers; i++ {
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				if errs.get() == nil {
+					s.progress(level, file.Path)
+					if err := s.searchFile(file, result, matchers.forPath(file.Path)); err != nil {
+						errs.set(err)
+					}
+				}
+				releaseEntry(file.fsys)
+			}
+		}()
+	}
+
+	// Every entry of an archive is acquired before any of them are searched, so that the
+	// archive is read at most once at this level.
+	files := cache.Slice()
+	for _, file := range files {
+		acquireEntry(file.fsys)
+	}
+	for _, file := range files {
+		jobs <- file
+	}
+	close(jobs)
+	wg.Wait()
+	return errs.get()
+}
+
+func (s *Searcher) progress(level int, path string) {
+	if s.options.Progress != nil {
+		s.options.Progress(level, path)
+	}
+}
+
+// The length in bytes of the longest file, beyond those held in the cache, that is read
+// into memory to extract the entities it defines. Longer files are used by their names.
+const MaxExtractSize = 16 * 1024 * 1024
+
+// Searches the given file for references found by the matcher, recording each of them
+// in the result, along with the names of the entities the file defines, if they can be
+// extracted from it.
+func (s *Searcher) searchFile(file *cachedFile, result *Result, matcher deps.Matcher) error {
+	reader, err := file.open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	references := []Reference{}
+	err = scanReader(reader, matcher, scanBufferSize, func(match deps.Match, line int, column int) {
+		references = append(references, Reference{Dependency: match.Dependency, Line: line, Column: column})
+	})
+	if err != nil || len(references) == 0 {
+		return err
+	}
+
+	// Definitions are only extracted from the files that reference a dependency, which
+	// are read again in full, unless they are too long to be, in which case they are
+	// recorded by their names.
+	var names []string
+	if extractor := ExtractorFor(file.Path); extractor != nil && !s.options.FileNamesOnly {
+		contents, ok, err := file.read(MaxExtractSize)
+		if err != nil {
+			return err
+		}
+		if ok {
+			names = extractor(contents)
+		}
+	}
+	for _, reference := range references {
+		reference.Repo = file.Repo
+		reference.Path = file.Path
+		reference.File = file.File
+		result.RecordReference(reference, names)
+	}
+	return nil
+}
+
+// A closed function encapsulating the regexp to strip extensions from
+// file names.
+func stripExtensionFunc() func(string) string {
+	stripExtensionRegexp, err := regexp.Compile("(.*)\\.[a-zA-Z]+$")
+	if err != nil {
+		log.Fatalf("Error parsing strip extension regex: %v", err)
+	}
+	return func(filename string) string {
+		return stripExtensionRegexp.ReplaceAllString(filename, "$1")
+	}
+}
+
+var stripExtension = stripExtensionFunc()
+
+// Strips extensions from file names.
+func StripExtension(filename string) string {
+	return stripExtension(filename)
+}
@@ -0,0 +1,464 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/andykuszyk/depgrok/deps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearcherSearch_ShouldFindSimpleDependency(t *testing.T) {
+	searcher, err := NewSearcher(Options{
+		FS:      []fs.FS{testTree()},
+		Seeds:   []string{"dependency1"},
+		Depth:   1,
+		Exclude: []string{"*.md"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating the searcher: %v", err)
+	}
+
+	result, err := searcher.Search()
+
+	if err != nil {
+		t.Fatalf("Unexpected error searching the test tree: %v", err)
+	}
+	slice := result.Dependencies.Slice()
+	if len(slice) != 2 {
+		t.Errorf("Expected there to be 2 dependencies, but there were %d", len(slice))
+	}
+	var dependency *deps.Dependency
+	for _, dep := range slice {
+		if dep.Name == "dependency1" {
+			dependency = dep
+			break
+		}
+	}
+	if len(dependency.Repos) != 1 {
+		t.Errorf("There should have been 1 repo for the dependency, but there were %d", len(dependency.Repos))
+	}
+	if !dependency.Repos["repo1"] {
+		var key string
+		for k, _ := range dependency.Repos {
+			key = k
+			break
+		}
+		t.Errorf("The repo should have been repo1, but it was %s", key)
+	}
+	assert.Equal(t, []Reference{{
+		Dependency: dependency,
+		Repo:       "repo1",
+		Path:       "repo1/file.lang",
+		File:       "file.lang",
+		Line:       1,
+		Column:     6,
+	}}, result.References)
+}
+
+func TestSearcherSearch_ShouldUseMatcherOption(t *testing.T) {
+	matched := []string{}
+	deps.RegisterMatcher("test-recording", func(dependencies []*deps.Dependency) (deps.Matcher, error) {
+		for _, dep := range dependencies {
+			matched = append(matched, dep.Name)
+		}
+		return deps.NewMultiMatcher(nil), nil
+	})
+	searcher, _ := NewSearcher(Options{
+		FS:      []fs.FS{testTree()},
+		Seeds:   []string{"dependency1"},
+		Depth:   1,
+		Matcher: "test-recording",
+	})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"dependency1"}, matched)
+	assert.Empty(t, result.References)
+}
+
+func TestSearcherSearch_ShouldSelectMatcherByFileAndDependency(t *testing.T) {
+	tree := fstest.MapFS{
+		"repo/query.sql":     {Data: []byte("SELECT * FROM [dbo].[Orders]\n")},
+		"repo/Repository.cs": {Data: []byte("var sql = \"Orders\"; // orders\n")},
+		"repo/Customers.cs":  {Data: []byte("new Customer();\n")},
+	}
+	searcher, _ := NewSearcher(Options{
+		FS:           []fs.FS{tree},
+		Seeds:        []string{"orders", "customer:case-insensitive"},
+		Depth:        1,
+		MatcherRules: []MatcherRule{{Glob: "*.sql", Matcher: "sql"}},
+	})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	found := []string{}
+	for _, reference := range result.References {
+		found = append(found, fmt.Sprintf("%s %s %d:%d", reference.Dependency.Name, filepath.Base(reference.Path), reference.Line, reference.Column))
+	}
+	assert.ElementsMatch(t, []string{
+		"orders query.sql 1:21",
+		"orders Repository.cs 1:24",
+		"customer Customers.cs 1:5",
+	}, found)
+}
+
+func TestSearcherSearch_ShouldReportPathsWithinRoots(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "repo1"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "repo1", "file.lang"), []byte("uses dependency1\n"), 0644)
+	searcher, _ := NewSearcher(Options{
+		Roots: []string{dir},
+		FS:    []fs.FS{testTree()},
+		Seeds: []string{"dependency1"},
+		Depth: 1,
+	})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	paths := []string{}
+	for _, reference := range result.References {
+		paths = append(paths, reference.Path)
+	}
+	assert.ElementsMatch(t, []string{filepath.Join(dir, "repo1", "file.lang"), "repo1/file.lang"}, paths)
+}
+
+func TestSearcherSearch_ShouldReportFilesWithinARootThatIsARepo(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "api")
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	os.MkdirAll(filepath.Join(dir, "src", "api"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "src", "api", "h.go"), []byte("uses dependency1\n"), 0644)
+	searcher, _ := NewSearcher(Options{Roots: []string{dir}, Seeds: []string{"dependency1"}, Depth: 1})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"api"}, result.Repos)
+	assert.Equal(t, filepath.Join(dir, "src", "api", "h.go"), result.References[0].Path)
+	assert.Equal(t, []ReportReference{{Dependency: "dependency1", Repo: "api", Path: "src/api/h.go", Line: 1, Column: 6}},
+		result.Report().References)
+}
+
+func TestNewSearcher_ShouldValidateOptions(t *testing.T) {
+	for _, options := range []Options{
+		{Seeds: []string{"a"}, Depth: 1},
+		{Roots: []string{"."}, Depth: 1},
+		{Roots: []string{"."}, Seeds: []string{"a"}},
+		{Roots: []string{"."}, Seeds: []string{"a"}, Depth: 1, Include: []string{"*.cs"}, Exclude: []string{"*.md"}},
+		{Roots: []string{"."}, Seeds: []string{"a"}, Depth: 1, Workers: -1},
+		{Roots: []string{"."}, Seeds: []string{"a"}, Depth: 1, Matcher: "missing"},
+		{Roots: []string{"."}, Seeds: []string{"a"}, Depth: 1, MatcherRules: []MatcherRule{{Glob: "*.sql", Matcher: "missing"}}},
+		{Roots: []string{"."}, Seeds: []string{"a"}, Depth: 1, MatcherRules: []MatcherRule{{Glob: "[", Matcher: "sql"}}},
+		{Roots: []string{"."}, Seeds: []string{"a"}, Depth: -2},
+		{Roots: []string{"."}, Seeds: []string{"a"}, Depth: UnlimitedDepth, MaxDepth: -1},
+		{Roots: []string{"."}, Seeds: []string{"a"}, Depth: 1, CacheBudget: -2},
+	} {
+		_, err := NewSearcher(options)
+
+		assert.NotNil(t, err, "%+v", options)
+	}
+}
+
+func TestNewSearcher_ShouldDefaultTheCacheBudget(t *testing.T) {
+	searcher, err := NewSearcher(Options{Roots: []string{"."}, Seeds: []string{"a"}, Depth: 1})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(DefaultCacheBudget), searcher.options.CacheBudget)
+}
+
+func TestSearcherSearch_ShouldReturnErrorForMissingRoot(t *testing.T) {
+	searcher, _ := NewSearcher(Options{Roots: []string{"does-not-exist"}, Seeds: []string{"a"}, Depth: 1})
+
+	_, err := searcher.Search()
+
+	assert.NotNil(t, err)
+}
+
+func TestResultRecord_ShouldIgnoreReferencesFromFilesOfTheSameName(t *testing.T) {
+	result := NewResult([]string{"orders"})
+	dep := result.Dependencies.Slice()[0]
+
+	result.Record(dep, "repo1", filepath.Join("repo1", "orders.sql"), 1, 1)
+	result.Record(dep, "repo2", filepath.Join("repo2", "GetOrders.sql"), 2, 3)
+
+	assert.Equal(t, map[string]bool{"repo2": true}, dep.Repos)
+	assert.Equal(t, 1, len(result.References))
+	assert.Equal(t, 1, len(result.Dependencies.Named("GetOrders")))
+}
+
+func TestStripExtension_WhenTwoExtensions(t *testing.T) {
+	result := StripExtension("file.txt.txt")
+	if result != "file.txt" {
+		t.Errorf("Expected file.txt, but got %s", result)
+	}
+}
+
+func TestStripExtension_WhenOneExtension(t *testing.T) {
+	result := StripExtension("file.txt")
+	if result != "file" {
+		t.Errorf("Expected file, but got %s", result)
+	}
+}
+
+// Generates a tree of repos, each file of which is named uniquely. One in every
+// referenceEvery files references dependency1.
+func generateTree(t *testing.T, repos int, dirs int, files int, referenceEvery int) string {
+	root, err := ioutil.TempDir("", "depgrok-tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for r := 0; r < repos; r++ {
+		for d := 0; d < dirs; d++ {
+			dir := filepath.Join(root, fmt.Sprintf("repo%d", r), fmt.Sprintf("dir%d", d))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			for f := 0; f < files; f++ {
+				contents := "nothing to see here\n"
+				if count%referenceEvery == 0 {
+					contents = "uses dependency1\n"
+				}
+				path := filepath.Join(dir, fmt.Sprintf("file%d.lang", count))
+				if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+				count++
+			}
+		}
+	}
+	return root
+}
+
+// Searches a large generated tree, which should be run with the race detector enabled
+// (i.e. go test -race) to check the worker pool's synchronisation.
+func TestSearcherSearch_ShouldSearchLargeTree(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping the generation of a large tree in short mode")
+	}
+	root := generateTree(t, 100, 100, 10, 1000)
+	defer os.RemoveAll(root)
+	searched := map[int]int{}
+	mutex := sync.Mutex{}
+	searcher, _ := NewSearcher(Options{
+		Roots:   []string{root},
+		Seeds:   []string{"dependency1"},
+		Depth:   2,
+		Workers: 8,
+		Progress: func(level int, path string) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			searched[level]++
+		},
+	})
+
+	result, err := searcher.Search()
+
+	if err != nil {
+		t.Fatalf("Unexpected error searching the tree: %v", err)
+	}
+	if searched[0] != 100000 || searched[1] != 100000 {
+		t.Errorf("Expected 100000 files to be searched at each level, but %v were", searched)
+	}
+	if result.Dependencies.Len() != 101 {
+		t.Errorf("Expected dependency1 and 100 referencing files as dependencies, but there were %d", result.Dependencies.Len())
+	}
+	if len(result.Dependencies.Slice()[0].Repos) != 100 {
+		t.Errorf("Expected dependency1 to be found in 100 repos, but it was found in %d", len(result.Dependencies.Slice()[0].Repos))
+	}
+}
+
+func TestFirstError_ShouldKeepFirstError(t *testing.T) {
+	errs := firstError{}
+	first := errors.New("first")
+
+	errs.set(first)
+	errs.set(errors.New("second"))
+
+	assert.Equal(t, first, errs.get())
+}
+
+func TestSearcherSearch_ShouldSearchRepos(t *testing.T) {
+	searcher, _ := NewSearcher(Options{
+		Repos: map[string]fs.FS{
+			"orders-service": fstest.MapFS{"src/Orders.cs": {Data: []byte("uses dependency1\n")}},
+			"reporting":      fstest.MapFS{"report.sql": {Data: []byte("dependency2\n")}},
+		},
+		Seeds: []string{"dependency1"},
+		Depth: 1,
+	})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result.References))
+	assert.Equal(t, "orders-service", result.References[0].Repo)
+	assert.Equal(t, "orders-service/src/Orders.cs", result.References[0].Path)
+}
+
+func TestSearcherSearches_ShouldApplyGlobs(t *testing.T) {
+	searcher, _ := NewSearcher(Options{Roots: []string{"."}, Seeds: []string{"a"}, Depth: 1, Include: []string{"*.sql"}})
+
+	assert.True(t, searcher.Searches("db/orders.sql"))
+	assert.False(t, searcher.Searches("src/Orders.cs"))
+	assert.False(t, searcher.Searches("bin/orders.sql"))
+	assert.False(t, searcher.Searches(".git/orders.sql"))
+}
+
+func TestSearcherMatcherFor_ShouldApplyMatcherRules(t *testing.T) {
+	searcher, _ := NewSearcher(Options{Roots: []string{"."}, Seeds: []string{"a"}, Depth: 1, MatcherRules: []MatcherRule{{Glob: "*.sql", Matcher: "sql"}}})
+	dependencies := []*deps.Dependency{{Name: "orders"}}
+
+	sqlMatcher, err := searcher.MatcherFor("db/query.sql", dependencies)
+	wordMatcher, _ := searcher.MatcherFor("src/Query.cs", dependencies)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sqlMatcher.FindAll(" [ORDERS] ")))
+	assert.Empty(t, wordMatcher.FindAll(" [ORDERS] "))
+}
+
+func TestSearcherSearch_ShouldNotConflateFilesOfTheSameNameInDifferentRepos(t *testing.T) {
+	tree := fstest.MapFS{
+		"repo1/Orders.sql":  {Data: []byte("select * from customers\n")},
+		"repo2/Orders.cs":   {Data: []byte("// no reference to the seed\n")},
+		"repo3/Checkout.cs": {Data: []byte("new Orders()\n")},
+	}
+	searcher, _ := NewSearcher(Options{FS: []fs.FS{tree}, Seeds: []string{"customers"}, Depth: 2})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	orders := result.Dependencies.Named("Orders")
+	assert.Equal(t, 1, len(orders))
+	assert.Equal(t, "repo1", orders[0].Repo)
+	assert.Equal(t, "Orders.sql", orders[0].Path)
+	texts := []string{}
+	for _, diagram := range result.Diagrams() {
+		texts = append(texts, diagram.Text)
+	}
+	assert.Equal(t, []string{"repo1 -> customers", "repo3 -> repo1:Orders -> customers"}, texts)
+}
+
+func TestResultRecord_ShouldNotPromoteNamesStoppedByTheNameFilter(t *testing.T) {
+	result := NewResult([]string{"orders"})
+	dep := result.Dependencies.Slice()[0]
+
+	result.Record(dep, "repo1", "repo1/Program.cs", 1, 1)
+	result.Record(dep, "repo1", "repo1/ab.cs", 1, 1)
+	result.Record(dep, "repo1", "repo1/OrderService.cs", 1, 1)
+
+	assert.Equal(t, 3, len(result.References))
+	assert.Equal(t, 0, len(result.Dependencies.Named("Program")))
+	assert.Equal(t, 0, len(result.Dependencies.Named("ab")))
+	assert.Equal(t, 1, len(result.Dependencies.Named("OrderService")))
+}
+
+func TestSearcherSearch_ShouldUseGivenNameFilter(t *testing.T) {
+	tree := fstest.MapFS{
+		"repo1/Program.cs": {Data: []byte("uses dependency1\n")},
+	}
+	searcher, _ := NewSearcher(Options{FS: []fs.FS{tree}, Seeds: []string{"dependency1"}, Depth: 1, NameFilter: &NameFilter{}})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result.Dependencies.Named("Program")))
+}
+
+func TestNewSearcher_ShouldReturnErrorForInvalidStopList(t *testing.T) {
+	_, err := NewSearcher(Options{Roots: []string{"."}, Seeds: []string{"a"}, Depth: 1, NameFilter: &NameFilter{StopList: []string{"["}}})
+
+	assert.NotNil(t, err)
+}
+
+func TestSearcherSearch_ShouldPropagateDefinitionsRatherThanFileNames(t *testing.T) {
+	tree := fstest.MapFS{
+		"db/deploy_042.sql":       {Data: []byte("CREATE PROCEDURE dbo.usp_GetOrders AS\nSELECT * FROM orders\n")},
+		"api/OrdersController.cs": {Data: []byte("db.Execute(\"usp_GetOrders\");\n")},
+		"web/release.js":          {Data: []byte("import { deploy_042 } from './x';\n")},
+	}
+
+	for _, fileNamesOnly := range []bool{false, true} {
+		searcher, _ := NewSearcher(Options{FS: []fs.FS{tree}, Seeds: []string{"orders"}, Depth: 2, FileNamesOnly: fileNamesOnly})
+
+		result, err := searcher.Search()
+
+		assert.Nil(t, err)
+		texts := []string{}
+		for _, diagram := range result.Diagrams() {
+			texts = append(texts, diagram.Text)
+		}
+		if fileNamesOnly {
+			assert.Equal(t, []string{"db -> orders", "web -> db:deploy_042 -> orders"}, texts)
+		} else {
+			assert.Equal(t, []string{"api -> db:usp_GetOrders -> orders", "db -> orders"}, texts)
+		}
+	}
+}
+
+func TestSearcherSearch_ShouldPropagateOtherDefinitionsOfAFileDefiningTheDependency(t *testing.T) {
+	tree := fstest.MapFS{
+		"db/schema.sql":           {Data: []byte("CREATE TABLE orders (id int);\nCREATE PROCEDURE usp_GetOrders AS\nSELECT * FROM orders\n")},
+		"api/OrdersController.cs": {Data: []byte("db.Execute(\"usp_GetOrders\");\n")},
+	}
+	searcher, _ := NewSearcher(Options{FS: []fs.FS{tree}, Seeds: []string{"orders"}, Depth: 2})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	texts := []string{}
+	for _, diagram := range result.Diagrams() {
+		texts = append(texts, diagram.Text)
+	}
+	assert.Equal(t, []string{"api -> db:usp_GetOrders -> orders", "db -> orders"}, texts)
+}
+
+func chainTree() fstest.MapFS {
+	return fstest.MapFS{
+		"repo1/one.sql":  {Data: []byte("CREATE VIEW vw_one AS\nSELECT * FROM orders\n")},
+		"repo2/two.sql":  {Data: []byte("CREATE VIEW vw_two AS\nSELECT * FROM vw_one\n")},
+		"repo3/Three.cs": {Data: []byte("class Three {\n  string view = \"vw_two\";\n}\n")},
+	}
+}
+
+func TestSearcherSearch_ShouldSearchUntilNoNewDependenciesWithUnlimitedDepth(t *testing.T) {
+	searcher, _ := NewSearcher(Options{FS: []fs.FS{chainTree()}, Seeds: []string{"orders"}, Depth: UnlimitedDepth})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 4, result.Levels)
+	assert.False(t, result.Truncated)
+	assert.Equal(t, 1, len(result.Dependencies.Named("Three")))
+}
+
+func TestSearcherSearch_ShouldStopAtMaxDepth(t *testing.T) {
+	searcher, _ := NewSearcher(Options{FS: []fs.FS{chainTree()}, Seeds: []string{"orders"}, Depth: UnlimitedDepth, MaxDepth: 2})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Levels)
+	assert.True(t, result.Truncated)
+	assert.Equal(t, 0, len(result.Dependencies.Named("Three")))
+}
+
+func TestSearcherSearch_ShouldReportLevelsSearchedWithFixedDepth(t *testing.T) {
+	searcher, _ := NewSearcher(Options{FS: []fs.FS{chainTree()}, Seeds: []string{"orders"}, Depth: 2})
+
+	result, err := searcher.Search()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Levels)
+	assert.False(t, result.Truncated)
+}
@@ -0,0 +1,153 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Writes the Report to a snapshot file at the given path, as JSON, so that it can later be
+// compared with another Report using DiffReports.
+func SaveSnapshot(path string, report Report) error {
+	contents, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(contents, '\n'), 0644)
+}
+
+// Reads the Report saved to a snapshot file at the given path by SaveSnapshot, or printed
+// by the search command with --format json.
+func LoadSnapshot(path string) (Report, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return Report{}, err
+	}
+	var report Report
+	if err := json.Unmarshal(contents, &report); err != nil {
+		return Report{}, fmt.Errorf("%s is not a snapshot: %v", path, err)
+	}
+	return report, nil
+}
+
+// Returns the names of the seed dependencies of the Report, i.e. those that were searched
+// for initially, in the order in which they were given.
+func (r Report) Seeds() []string {
+	seeds := []string{}
+	for _, dep := range r.Dependencies {
+		if dep.Level == 0 {
+			seeds = append(seeds, dep.Name)
+		}
+	}
+	return seeds
+}
+
+// Represents the differences between two Reports, such as a snapshot taken last week and
+// a fresh search. Edges include the references from each repo to each dependency, with
+// the repo as their From, as well as those between dependencies.
+type ReportDiff struct {
+	AddedRepos        []string          `json:"addedRepos"`
+	RemovedRepos      []string          `json:"removedRepos"`
+	AddedEdges        []ReportEdge      `json:"addedEdges"`
+	RemovedEdges      []ReportEdge      `json:"removedEdges"`
+	AddedReferences   []ReportReference `json:"addedReferences"`
+	RemovedReferences []ReportReference `json:"removedReferences"`
+}
+
+// Returns true if there are no differences between the Reports.
+func (d ReportDiff) Empty() bool {
+	return len(d.AddedRepos) == 0 && len(d.RemovedRepos) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0 &&
+		len(d.AddedReferences) == 0 && len(d.RemovedReferences) == 0
+}
+
+// Returns the differences between the before and after Reports: the repos that started or
+// stopped referencing any dependency, the edges that were added or removed, and the
+// locations of the references that were added or removed. A reference that has moved,
+// e.g. because lines were added above it, is reported as removed from its old location
+// and added at its new one.
+func DiffReports(before Report, after Report) ReportDiff {
+	return ReportDiff{
+		AddedRepos:        missingRepos(reportRepos(after), reportRepos(before)),
+		RemovedRepos:      missingRepos(reportRepos(before), reportRepos(after)),
+		AddedEdges:        missingEdges(reportEdges(after), reportEdges(before)),
+		RemovedEdges:      missingEdges(reportEdges(before), reportEdges(after)),
+		AddedReferences:   missingReferences(after.References, before.References),
+		RemovedReferences: missingReferences(before.References, after.References),
+	}
+}
+
+// Returns the repos that reference any dependency of the Report, sorted by name.
+func reportRepos(report Report) []string {
+	repos := []string{}
+	seen := map[string]bool{}
+	for _, dep := range report.Dependencies {
+		for _, repo := range dep.Repos {
+			if !seen[repo] {
+				seen[repo] = true
+				repos = append(repos, repo)
+			}
+		}
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+// Returns the edges of the Report, along with an edge from each repo to each dependency it
+// references, sorted by their From and To.
+func reportEdges(report Report) []ReportEdge {
+	edges := append([]ReportEdge{}, report.Edges...)
+	for _, dep := range report.Dependencies {
+		for _, repo := range dep.Repos {
+			edges = append(edges, ReportEdge{From: repo, To: dep.ID})
+		}
+	}
+	sortEdges(edges)
+	return edges
+}
+
+// Returns the repos that are not amongst the others.
+func missingRepos(repos []string, others []string) []string {
+	excluded := map[string]bool{}
+	for _, other := range others {
+		excluded[other] = true
+	}
+	missing := []string{}
+	for _, repo := range repos {
+		if !excluded[repo] {
+			missing = append(missing, repo)
+		}
+	}
+	return missing
+}
+
+// Returns the edges that are not amongst the others.
+func missingEdges(edges []ReportEdge, others []ReportEdge) []ReportEdge {
+	excluded := map[ReportEdge]bool{}
+	for _, other := range others {
+		excluded[other] = true
+	}
+	missing := []ReportEdge{}
+	for _, edge := range edges {
+		if !excluded[edge] {
+			missing = append(missing, edge)
+		}
+	}
+	return missing
+}
+
+// Returns the references that are not amongst the others.
+func missingReferences(references []ReportReference, others []ReportReference) []ReportReference {
+	excluded := map[ReportReference]bool{}
+	for _, other := range others {
+		excluded[other] = true
+	}
+	missing := []ReportReference{}
+	for _, reference := range references {
+		if !excluded[reference] {
+			missing = append(missing, reference)
+		}
+	}
+	return missing
+}
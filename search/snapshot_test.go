@@ -0,0 +1,85 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveSnapshot_ShouldBeLoadedAsTheSameReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	report := searchRoutes(t).Report()
+
+	err := SaveSnapshot(path, report)
+	loaded, loadErr := LoadSnapshot(path)
+
+	assert.Nil(t, err)
+	assert.Nil(t, loadErr)
+	assert.Equal(t, report, loaded)
+	assert.Equal(t, []string{"orders"}, loaded.Seeds())
+}
+
+func TestDiffReports_ShouldListAddedAndRemovedReposEdgesAndReferences(t *testing.T) {
+	before := NewResult([]string{"orders"})
+	dep := before.Dependencies.Slice()[0]
+	before.Record(dep, "repo1", "repo1/Checkout.cs", 1, 2)
+	before.Record(dep, "repo2", "repo2/Billing.cs", 3, 5)
+	after := NewResult([]string{"orders"})
+	dep = after.Dependencies.Slice()[0]
+	after.Record(dep, "repo1", "repo1/Checkout.cs", 1, 2)
+	after.Record(dep, "repo3", "repo3/Shipping.cs", 4, 1)
+
+	diff := DiffReports(before.Report(), after.Report())
+
+	assert.Equal(t, []string{"repo3"}, diff.AddedRepos)
+	assert.Equal(t, []string{"repo2"}, diff.RemovedRepos)
+	assert.Equal(t, []ReportEdge{
+		{From: "repo3", To: "orders"},
+		{From: "repo3:Shipping.cs:Shipping", To: "orders"},
+	}, diff.AddedEdges)
+	assert.Equal(t, []ReportEdge{
+		{From: "repo2", To: "orders"},
+		{From: "repo2:Billing.cs:Billing", To: "orders"},
+	}, diff.RemovedEdges)
+	assert.Equal(t, []ReportReference{{Dependency: "orders", Repo: "repo3", Path: "Shipping.cs", Line: 4, Column: 1}}, diff.AddedReferences)
+	assert.Equal(t, []ReportReference{{Dependency: "orders", Repo: "repo2", Path: "Billing.cs", Line: 3, Column: 5}}, diff.RemovedReferences)
+	assert.False(t, diff.Empty())
+}
+
+func TestDiffReports_ShouldBeEmptyForTheSameReport(t *testing.T) {
+	report := searchRoutes(t).Report()
+
+	diff := DiffReports(report, report)
+
+	assert.True(t, diff.Empty())
+}
+
+func TestDiffReports_ShouldBeEmptyForReposFoundInDifferentDirectories(t *testing.T) {
+	reportIn := func(dir string) Report {
+		root := filepath.Join(t.TempDir(), dir)
+		for name, contents := range map[string]string{
+			"repo1/db/Orders.sql":  "create view vw_orders as select * from orders\n",
+			"repo2/src/Billing.cs": "var orders = query(\"vw_orders\");\n",
+		} {
+			path := filepath.Join(root, filepath.FromSlash(name))
+			os.MkdirAll(filepath.Dir(path), 0755)
+			os.WriteFile(path, []byte(contents), 0644)
+		}
+		searcher, _ := NewSearcher(Options{Roots: []string{root}, Seeds: []string{"orders"}, Depth: 2})
+		result, err := searcher.Search()
+		if err != nil {
+			t.Fatalf("Unexpected error searching: %v", err)
+		}
+		return result.Report()
+	}
+	before := reportIn("agent1/repos")
+	after := reportIn("repos")
+
+	diff := DiffReports(before, after)
+
+	assert.NotEmpty(t, after.Edges)
+	assert.Equal(t, "db/Orders.sql", after.References[0].Path)
+	assert.True(t, diff.Empty(), "%+v", diff)
+}
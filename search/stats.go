@@ -0,0 +1,94 @@
+package search
+
+import (
+	"sort"
+
+	"github.com/andykuszyk/depgrok/deps"
+)
+
+// Represents how widely used a dependency is within the graph of a Result.
+type DependencyStats struct {
+	Dependency *deps.Dependency
+	// The number of files that reference the dependency.
+	FanIn int
+	// The number of dependencies that the dependency references, which is only ever more
+	// than 0 for an intermediate dependency.
+	FanOut int
+	// The number of repos that reference the dependency directly, and those that reference
+	// it either directly or through a chain of other dependencies.
+	Repos           int
+	TransitiveRepos int
+	// The number of dependencies that reference the dependency, either directly or through
+	// a chain of other dependencies, which is used to rank how central it is.
+	Dependents int
+}
+
+// Returns the DependencyStats of every dependency found, ranked by how central each is to
+// the graph: by the number of repos that reference it transitively, then by its number
+// of Dependents, then by its FanIn, and finally by its Key.
+func (r *Result) Stats() []DependencyStats {
+	r.mutex.Lock()
+	dependents := map[*deps.Dependency][]*deps.Dependency{}
+	fanOut := map[*deps.Dependency]int{}
+	for from, tos := range r.edges {
+		fanOut[from] = len(tos)
+		for to := range tos {
+			dependents[to] = append(dependents[to], from)
+		}
+	}
+	files := map[*deps.Dependency]map[fileKey]bool{}
+	for _, reference := range r.References {
+		if files[reference.Dependency] == nil {
+			files[reference.Dependency] = map[fileKey]bool{}
+		}
+		files[reference.Dependency][fileKey{Repo: reference.Repo, Path: reference.Path}] = true
+	}
+	r.mutex.Unlock()
+
+	stats := []DependencyStats{}
+	for _, dep := range r.Dependencies.Slice() {
+		repos := map[string]bool{}
+		for repo := range dep.Repos {
+			repos[repo] = true
+		}
+		// Walk back through everything that reaches the dependency.
+		visited := map[*deps.Dependency]bool{dep: true}
+		queue := []*deps.Dependency{dep}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, dependent := range dependents[current] {
+				if visited[dependent] {
+					continue
+				}
+				visited[dependent] = true
+				queue = append(queue, dependent)
+				for repo := range dependent.Repos {
+					repos[repo] = true
+				}
+			}
+		}
+		stats = append(stats, DependencyStats{
+			Dependency:      dep,
+			FanIn:           len(files[dep]),
+			FanOut:          fanOut[dep],
+			Repos:           len(dep.Repos),
+			TransitiveRepos: len(repos),
+			Dependents:      len(visited) - 1,
+		})
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.TransitiveRepos != b.TransitiveRepos {
+			return a.TransitiveRepos > b.TransitiveRepos
+		}
+		if a.Dependents != b.Dependents {
+			return a.Dependents > b.Dependents
+		}
+		if a.FanIn != b.FanIn {
+			return a.FanIn > b.FanIn
+		}
+		return a.Dependency.Key() < b.Dependency.Key()
+	})
+	return stats
+}
@@ -0,0 +1,35 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultStats_ShouldRankDependenciesByTheReposReachingThem(t *testing.T) {
+	result := searchRoutes(t)
+
+	stats := result.Stats()
+
+	names := []string{}
+	for _, s := range stats {
+		names = append(names, s.Dependency.DisplayName())
+	}
+	assert.Equal(t, []string{"orders", "repo1:vw_one", "repo2:vw_two", "repo3:Four", "repo3:Three"}, names)
+}
+
+func TestResultStats_ShouldCountDirectAndTransitiveUse(t *testing.T) {
+	result := searchRoutes(t)
+
+	stats := result.Stats()
+
+	assert.Equal(t, 2, stats[0].FanIn)
+	assert.Equal(t, 0, stats[0].FanOut)
+	assert.Equal(t, 2, stats[0].Repos)
+	assert.Equal(t, 3, stats[0].TransitiveRepos)
+	assert.Equal(t, 4, stats[0].Dependents)
+	assert.Equal(t, 2, stats[1].FanIn)
+	assert.Equal(t, 1, stats[1].FanOut)
+	assert.Equal(t, 2, stats[1].TransitiveRepos)
+	assert.Equal(t, 2, stats[1].Dependents)
+}
@@ -0,0 +1,232 @@
+package search
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Returns true if the given parent is a valid candidate for a search,
+// otherwise false is returned (e.g. in the case of a filename beginning
+// with ".".
+func isValidParent(parent string) bool {
+	return !(strings.HasPrefix(parent, ".") || parent == "bin" || parent == "obj")
+}
+
+// Returns true if the name of the file or directory at the given path matches any of the
+// given globs.
+func matchesGlob(name string, globs []string) bool {
+	base := path.Base(filepath.ToSlash(name))
+	for _, glob := range globs {
+		if matched, _ := path.Match(glob, base); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Globs of the files that mark the roots of the modules and projects of common build tools:
+// Go modules, npm packages (including the packages of workspaces), .NET projects, Maven and
+// Gradle modules, Rust crates and Python projects. Given as RepoMarkers, these divide a
+// monorepo into its modules.
+var ModuleMarkers = []string{
+	"go.mod", "package.json", "*.csproj", "*.fsproj", "*.vbproj", "pom.xml", "build.gradle",
+	"build.gradle.kts", "Cargo.toml", "pyproject.toml", "setup.py",
+}
+
+// Called by Walk and WalkFS for each file that should be searched.
+type WalkFunc func(repo string, path string, info fs.FileInfo) error
+
+// Configures which files are passed to a WalkFunc by Walk and WalkFS, and how they are
+// divided into repos.
+type WalkOptions struct {
+	// Globs of files to skip, or to pass at the exclusion of all others.
+	Exclude []string
+	Include []string
+
+	// If greater than zero, the repos are taken to be the directories at this depth, e.g.
+	// a depth of 2 suits a layout of org/repo. Otherwise, repos are detected by the .git
+	// directories (or files) within them, and by RepoMarkers.
+	RepoDepth int
+
+	// Globs of files whose presence in a directory marks it as the root of a repo, e.g.
+	// go.mod, package.json or *.csproj, which allows the projects within a monorepo to be
+	// told apart.
+	RepoMarkers []string
+}
+
+// Walks the file tree under dir, calling fn for each file that should be searched, as per
+// WalkFS. The paths passed to fn are those of the files on disk, i.e. they begin with dir.
+// If dir is itself the root of a repo, it is walked as that single repo, as per RootRepo.
+func Walk(dir string, options WalkOptions, fn WalkFunc) error {
+	return walkFS(os.DirFS(dir), RootRepo(dir, options), options, func(repo string, name string, info fs.FileInfo) error {
+		return fn(repo, filepath.Join(dir, filepath.FromSlash(name)), info)
+	})
+}
+
+// Returns the name of the repo held by dir, if dir is itself the root of a repo rather than
+// a directory of repos, e.g. when searching from within a clone. The repo is named after
+// the directory, so that the paths of its files within it are not mistaken for repos. An
+// empty string is returned if dir is not the root of a repo, or if the options give a
+// RepoDepth.
+func RootRepo(dir string, options WalkOptions) string {
+	if options.RepoDepth > 0 || !isRepoRoot(os.DirFS(dir), ".", options.RepoMarkers) {
+		return ""
+	}
+	absolute, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(absolute)
+}
+
+// Returns the directory on disk of a repo found by walking dir, given the repo's name.
+func RepoDir(dir string, repo string, options WalkOptions) string {
+	if root := RootRepo(dir, options); root != "" && (repo == root || strings.HasPrefix(repo, root+"/")) {
+		return filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(repo, root)))
+	}
+	return filepath.Join(dir, filepath.FromSlash(repo))
+}
+
+// Walks the file system, calling fn for each file that should be searched, along with
+// the repo it belongs to and its slash-separated path within the file system. Hidden files
+// and directories, bin and obj directories, and anything matching the exclude globs are
+// skipped, and if any include globs are given, only files matching them are passed to fn.
+//
+// Each repo is identified by the slash-separated path of its root directory, e.g.
+// org/team/repo. Unless the options give a RepoDepth, the root of a repo is the innermost
+// directory containing the file that has a .git entry, or a file matching one of the
+// RepoMarkers. Files outside of any such directory are taken to belong to the top-level
+// directory containing them.
+func WalkFS(fsys fs.FS, options WalkOptions, fn WalkFunc) error {
+	return walkFS(fsys, "", options, fn)
+}
+
+// Walks the file system as per WalkFS, unless repo is given, in which case the file
+// system is taken to hold that single repo, rather than a directory of repos. The
+// directories within it that match the RepoMarkers are still reported as repos of their
+// own, e.g. repo/services/billing.
+func walkFS(fsys fs.FS, repo string, options WalkOptions, fn WalkFunc) error {
+	roots := map[string]bool{}
+	return fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		if !isValidParent(entry.Name()) || matchesGlob(name, options.Exclude) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if (repo != "" || options.RepoDepth <= 0) && isRepoRoot(fsys, name, options.RepoMarkers) {
+				roots[name] = true
+			}
+			return nil
+		}
+		if len(options.Include) > 0 && !matchesGlob(name, options.Include) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if repo != "" {
+			// Any repos found within the repo, e.g. the modules of a monorepo, are reported
+			// by their paths within it.
+			if root := rootOf(name, roots); root != "" {
+				return fn(repo+"/"+root, name, info)
+			}
+			return fn(repo, name, info)
+		}
+		return fn(repoOf(name, roots, options.RepoDepth), name, info)
+	})
+}
+
+// Returns true if the directory at name has a .git entry, or a file matching one of the
+// given markers.
+func isRepoRoot(fsys fs.FS, name string, markers []string) bool {
+	if _, err := fs.Stat(fsys, path.Join(name, ".git")); err == nil {
+		return true
+	}
+	if len(markers) == 0 {
+		return false
+	}
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && matchesGlob(entry.Name(), markers) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the repo containing the file at name: the directory at the given depth, if it is
+// greater than zero, or else the innermost of the given roots that contains the file,
+// falling back to the top-level directory containing it.
+func repoOf(name string, roots map[string]bool, depth int) string {
+	parts := strings.Split(name, "/")
+	if depth > 0 {
+		if depth > len(parts)-1 {
+			depth = len(parts) - 1
+		}
+		if depth < 1 {
+			depth = 1
+		}
+		return strings.Join(parts[:depth], "/")
+	}
+	if root := rootOf(name, roots); root != "" {
+		return root
+	}
+	return parts[0]
+}
+
+// Returns the innermost of the given roots that contains the file at name, or an empty
+// string if none of them do.
+func rootOf(name string, roots map[string]bool) string {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if roots[dir] {
+			return dir
+		}
+	}
+	return ""
+}
+
+// Returns the slash-separated paths of the roots of the repos within the file system, as
+// found by WalkFS, without walking any of the files within them. Since the roots are not
+// detected if the options give a RepoDepth, the directories at that depth are returned
+// instead.
+func FindRepos(fsys fs.FS, options WalkOptions) ([]string, error) {
+	repos := []string{}
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." || !entry.IsDir() {
+			return nil
+		}
+		if !isValidParent(entry.Name()) || matchesGlob(name, options.Exclude) {
+			return fs.SkipDir
+		}
+		if options.RepoDepth > 0 {
+			if strings.Count(name, "/")+1 == options.RepoDepth {
+				repos = append(repos, name)
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if isRepoRoot(fsys, name, options.RepoMarkers) {
+			repos = append(repos, name)
+		}
+		return nil
+	})
+	return repos, err
+}
@@ -0,0 +1,230 @@
+package search
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns an in-memory tree of repos to search, along with some files that should be
+// skipped whilst walking it.
+func testTree() fstest.MapFS {
+	return fstest.MapFS{
+		"repo1/file.lang":       {Data: []byte("uses dependency1\n")},
+		"repo1/.git/HEAD":       {Data: []byte("uses dependency1\n")},
+		"repo1/bin/file.lang":   {Data: []byte("uses dependency1\n")},
+		"repo2/dependency1.sql": {Data: []byte("dependency1\n")},
+		"repo3/README.md":       {Data: []byte("dependency1\n")},
+		"repo4/thing.lang":      {Data: []byte("amongstdependency1othertext\n")},
+	}
+}
+
+func walkTestTree(t *testing.T, exclude []string, include []string) map[string]string {
+	files := map[string]string{}
+	err := WalkFS(testTree(), WalkOptions{Exclude: exclude, Include: include}, func(repo string, path string, info fs.FileInfo) error {
+		files[path] = repo
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error walking the test tree: %v", err)
+	}
+	return files
+}
+
+func TestWalkFS_ShouldReturnEachFileWithItsRepo(t *testing.T) {
+	files := walkTestTree(t, nil, nil)
+
+	expected := map[string]string{
+		"repo1/file.lang":       "repo1",
+		"repo2/dependency1.sql": "repo2",
+		"repo3/README.md":       "repo3",
+		"repo4/thing.lang":      "repo4",
+	}
+	if len(files) != len(expected) {
+		t.Errorf("Expected %d files, but got %v", len(expected), files)
+	}
+	for path, repo := range expected {
+		if files[path] != repo {
+			t.Errorf("Expected %s to be in %s, but it was in %q", path, repo, files[path])
+		}
+	}
+}
+
+func TestWalkFS_ShouldSkipExcludedFiles(t *testing.T) {
+	files := walkTestTree(t, []string{"*.md", "repo2"}, nil)
+
+	if len(files) != 2 || files["repo1/file.lang"] == "" || files["repo4/thing.lang"] == "" {
+		t.Errorf("Expected only file.lang and thing.lang, but got %v", files)
+	}
+}
+
+func TestWalkFS_ShouldOnlyReturnIncludedFiles(t *testing.T) {
+	files := walkTestTree(t, nil, []string{"*.sql"})
+
+	if len(files) != 1 || files["repo2/dependency1.sql"] != "repo2" {
+		t.Errorf("Expected only dependency1.sql, but got %v", files)
+	}
+}
+
+func TestWalk_ShouldReturnPathsOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "repo1", "src"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "repo1", "src", "file.lang"), []byte("uses dependency1\n"), 0644)
+	paths := []string{}
+
+	err := Walk(dir, WalkOptions{}, func(repo string, path string, info fs.FileInfo) error {
+		paths = append(paths, repo+" "+path)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error walking %s: %v", dir, err)
+	}
+	expected := "repo1 " + filepath.Join(dir, "repo1", "src", "file.lang")
+	if len(paths) != 1 || paths[0] != expected {
+		t.Errorf("Expected %s, but got %v", expected, paths)
+	}
+}
+
+func TestWalk_ShouldWalkADirectoryThatIsARepoAsThatRepo(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "orders")
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	os.MkdirAll(filepath.Join(dir, "src", "db"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "src", "db", "x.sql"), []byte("select 1\n"), 0644)
+	paths := []string{}
+
+	err := Walk(dir, WalkOptions{}, func(repo string, path string, info fs.FileInfo) error {
+		paths = append(paths, repo+" "+path)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"orders " + filepath.Join(dir, "src", "db", "x.sql")}, paths)
+	assert.Equal(t, dir, RepoDir(dir, "orders", WalkOptions{}))
+	assert.Equal(t, filepath.Join(dir, "api"), RepoDir(dir, "orders/api", WalkOptions{}))
+	assert.Equal(t, "", RootRepo(dir, WalkOptions{RepoDepth: 1}))
+}
+
+func TestRootRepo_ShouldDetectADirectoryThatIsARepoByItsMarkers(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "billing")
+	os.MkdirAll(filepath.Join(dir, "api"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module billing\n"), 0644)
+
+	assert.Equal(t, "", RootRepo(dir, WalkOptions{}))
+	assert.Equal(t, "billing", RootRepo(dir, WalkOptions{RepoMarkers: []string{"go.mod"}}))
+	assert.Equal(t, filepath.Join(dir, "api"), RepoDir(dir, "api", WalkOptions{}))
+	assert.Equal(t, dir, RepoDir(dir, "billing", WalkOptions{RepoMarkers: []string{"go.mod"}}))
+}
+
+func walkRepos(t *testing.T, tree fstest.MapFS, options WalkOptions) map[string]string {
+	files := map[string]string{}
+	err := WalkFS(tree, options, func(repo string, path string, info fs.FileInfo) error {
+		files[path] = repo
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error walking the tree: %v", err)
+	}
+	return files
+}
+
+// Returns a tree of repos nested at different depths, including a monorepo of projects.
+func nestedTree() fstest.MapFS {
+	return fstest.MapFS{
+		"README.md":                             {},
+		"org/team/orders/.git/HEAD":             {},
+		"org/team/orders/db/orders.sql":         {},
+		"org/customers/.git":                    {Data: []byte("gitdir: ../.git/modules/customers")},
+		"org/customers/customers.sql":           {},
+		"monorepo/.git/HEAD":                    {},
+		"monorepo/build.sh":                     {},
+		"monorepo/services/billing/go.mod":      {},
+		"monorepo/services/billing/cmd/main.go": {},
+		"monorepo/web/package.json":             {},
+		"monorepo/web/src/index.js":             {},
+		"loose/notes.txt":                       {},
+	}
+}
+
+func TestWalkFS_ShouldDetectReposByGitDirectories(t *testing.T) {
+	files := walkRepos(t, nestedTree(), WalkOptions{})
+
+	assert.Equal(t, map[string]string{
+		"README.md":                             "README.md",
+		"org/team/orders/db/orders.sql":         "org/team/orders",
+		"org/customers/customers.sql":           "org/customers",
+		"monorepo/build.sh":                     "monorepo",
+		"monorepo/services/billing/go.mod":      "monorepo",
+		"monorepo/services/billing/cmd/main.go": "monorepo",
+		"monorepo/web/package.json":             "monorepo",
+		"monorepo/web/src/index.js":             "monorepo",
+		"loose/notes.txt":                       "loose",
+	}, files)
+}
+
+func TestWalkFS_ShouldDetectReposByMarkers(t *testing.T) {
+	files := walkRepos(t, nestedTree(), WalkOptions{RepoMarkers: []string{"go.mod", "package.json"}})
+
+	assert.Equal(t, "monorepo", files["monorepo/build.sh"])
+	assert.Equal(t, "monorepo/services/billing", files["monorepo/services/billing/cmd/main.go"])
+	assert.Equal(t, "monorepo/web", files["monorepo/web/src/index.js"])
+}
+
+func TestWalkFS_ShouldUseRepoDepth(t *testing.T) {
+	files := walkRepos(t, nestedTree(), WalkOptions{RepoDepth: 2})
+
+	assert.Equal(t, "org/team", files["org/team/orders/db/orders.sql"])
+	assert.Equal(t, "monorepo/services", files["monorepo/services/billing/go.mod"])
+	assert.Equal(t, "monorepo", files["monorepo/build.sh"])
+	assert.Equal(t, "README.md", files["README.md"])
+}
+
+func TestFindRepos_ShouldReturnRepoRoots(t *testing.T) {
+	repos, err := FindRepos(nestedTree(), WalkOptions{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"monorepo", "org/customers", "org/team/orders"}, repos)
+
+	repos, err = FindRepos(nestedTree(), WalkOptions{RepoDepth: 2})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"monorepo/services", "monorepo/web", "org/customers", "org/team"}, repos)
+}
+
+func TestWalkFS_ShouldDetectModulesByModuleMarkers(t *testing.T) {
+	tree := nestedTree()
+	tree["monorepo/lib/Orders/Orders.csproj"] = &fstest.MapFile{}
+	tree["monorepo/lib/Orders/Repository.cs"] = &fstest.MapFile{}
+
+	files := walkRepos(t, tree, WalkOptions{RepoMarkers: ModuleMarkers})
+
+	assert.Equal(t, "monorepo/services/billing", files["monorepo/services/billing/cmd/main.go"])
+	assert.Equal(t, "monorepo/web", files["monorepo/web/src/index.js"])
+	assert.Equal(t, "monorepo/lib/Orders", files["monorepo/lib/Orders/Repository.cs"])
+	assert.Equal(t, "monorepo", files["monorepo/build.sh"])
+}
+
+func TestWalkFS_ShouldDetectModulesWithinSingleRepo(t *testing.T) {
+	monorepo, err := fs.Sub(nestedTree(), "monorepo")
+	assert.Nil(t, err)
+	files := map[string]string{}
+
+	err = walkFS(monorepo, "monorepo", WalkOptions{RepoMarkers: ModuleMarkers}, func(repo string, path string, info fs.FileInfo) error {
+		files[path] = repo
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"build.sh":                     "monorepo",
+		"services/billing/go.mod":      "monorepo/services/billing",
+		"services/billing/cmd/main.go": "monorepo/services/billing",
+		"web/package.json":             "monorepo/web",
+		"web/src/index.js":             "monorepo/web",
+	}, files)
+}
@@ -1 +0,0 @@
-dependency1